@@ -0,0 +1,66 @@
+// Lists the notification history of an application.
+//
+//	notify-history -app backup -since 24h -severity warning
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/johannes-luebke/gotool/pkg/notify"
+)
+
+func main() {
+	app := flag.String("app", "", "application name (required unless -dir is set)")
+	dir := flag.String("dir", "", "user directory of the application. Defaults to its state directory")
+	since := flag.Duration("since", 0, "only show notifications of the last duration, e.g. 24h")
+	severity := flag.String("severity", "info", "minimum severity: info, warning or error")
+	status := flag.String("status", "", "only show this status: delivered, failed, suppressed or held")
+	tag := flag.String("tag", "", "only show notifications with this tag")
+	grep := flag.String("grep", "", "only show notifications containing this text")
+	limit := flag.Int("n", 50, "maximum number of notifications. 0 shows all")
+	asJSON := flag.Bool("json", false, "print JSON lines")
+	flag.Parse()
+
+	if *app == "" && *dir == "" {
+		fmt.Fprintln(os.Stderr, "either -app or -dir is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	q := notify.HistoryQuery{
+		Status: notify.DeliveryStatus(*status),
+		Tag:    *tag,
+		Text:   *grep,
+		Limit:  *limit,
+	}
+	err := q.MinSeverity.UnmarshalText([]byte(*severity))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *since > 0 {
+		q.Since = time.Now().Add(-*since)
+	}
+	h, err := notify.ReadHistory(notify.HistoryOptions{UserDir: *dir, AppName: *app})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	entries, err := h.Query(q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Print oldest first, like a log
+	enc := json.NewEncoder(os.Stdout)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if *asJSON {
+			enc.Encode(entries[i])
+		} else {
+			fmt.Println(entries[i])
+		}
+	}
+}
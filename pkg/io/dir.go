@@ -0,0 +1,74 @@
+package io
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Returns the directory for persistent application state, e.g. logs and history.
+//
+//  1. $<APP>_STATE_DIR, e.g. $MY_APP_STATE_DIR for "my-app"
+//  2. $XDG_STATE_HOME/<app>
+//  3. The OS convention:
+//     Linux & others: ~/.local/state/<app>
+//     macOS:          ~/Library/Application Support/<app>
+//     Windows:        %LocalAppData%\<app>
+//
+// The directory is not created.
+func UserStateDir(app string) (string, error) {
+	if app == "" {
+		return "", fmt.Errorf("app name cannot be empty")
+	}
+	if dir := os.Getenv(StateDirEnv(app)); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, app), nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		dir, err := os.UserCacheDir() // %LocalAppData%
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, app), nil
+	case "darwin", "ios":
+		dir, err := os.UserConfigDir() // ~/Library/Application Support
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, app), nil
+	default:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "state", app), nil
+	}
+}
+
+// Returns the environment variable overriding the state directory of an app.
+//
+//	"my-app" -> "MY_APP_STATE_DIR"
+func StateDirEnv(app string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, app)
+	return name + "_STATE_DIR"
+}
+
+// Returns the name of the running executable without extension.
+func AppName() string {
+	name := filepath.Base(os.Args[0])
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
@@ -0,0 +1,59 @@
+package io
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUserStateDir(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+	fallback := filepath.Join(home, ".local", "state", "my-app")
+	tests := []struct {
+		name     string
+		override string // $MY_APP_STATE_DIR
+		xdg      string // $XDG_STATE_HOME
+		want     string
+		os       bool // depends on the OS convention
+	}{
+		{"override", "/custom/state", xdg, "/custom/state", false},
+		{"XDG_STATE_HOME", "", xdg, filepath.Join(xdg, "my-app"), false},
+		{"relative XDG_STATE_HOME", "", "state", fallback, true},
+		{"fallback", "", "", fallback, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.os && (runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "ios") {
+				t.Skip("uses the OS convention of", runtime.GOOS)
+			}
+			t.Setenv("HOME", home)
+			t.Setenv(StateDirEnv("my-app"), tt.override)
+			t.Setenv("XDG_STATE_HOME", tt.xdg)
+			got, err := UserStateDir("my-app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("UserStateDir = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := UserStateDir(""); err == nil {
+		t.Error("empty app name accepted")
+	}
+}
+
+func TestStateDirEnv(t *testing.T) {
+	tests := map[string]string{
+		"my-app":  "MY_APP_STATE_DIR",
+		"App2.go": "APP2_GO_STATE_DIR",
+		"äpp":     "_PP_STATE_DIR",
+	}
+	for app, want := range tests {
+		if got := StateDirEnv(app); got != want {
+			t.Errorf("StateDirEnv(%q) = %s, want %s", app, got, want)
+		}
+	}
+}
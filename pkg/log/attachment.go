@@ -0,0 +1,105 @@
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	toolio "github.com/johannes-luebke/gotool/pkg/io"
+)
+
+const (
+	attachmentKey        = "attachment"
+	attachmentHashKey    = "sha256"
+	attachmentPathKey    = "path"
+	attachmentFolderName = "attachments"
+)
+
+// Stores a large payload beside the log file and returns an attribute referencing it.
+//
+//	The payload is written to <UserDir>/log/attachments/<log file>/<sha256>,
+//	so identical payloads are stored only once per log file.
+//	It is written when a handler resolves the attribute, so records below the level don't leave files behind.
+//	Attachments are rotated and deleted together with their log file.
+//
+//	log.Log.Debug("Request failed.", log.Attachment("body", body))
+func Attachment(name string, data []byte) slog.Attr {
+	return slog.Any(name, attachment{name, data})
+}
+
+// Payload of Attachment, stored once it is logged.
+type attachment struct {
+	name string
+	data []byte
+}
+
+func (a attachment) LogValue() slog.Value {
+	sum := sha256.Sum256(a.data)
+	hash := hex.EncodeToString(sum[:])
+	attrs := []slog.Attr{
+		slog.String(attachmentKey, a.name),
+		slog.String(attachmentHashKey, hash),
+		slog.Int("size", len(a.data)),
+	}
+	err := writeAttachment(hash, a.data)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func writeAttachment(hash string, data []byte) error {
+	if logFile == "" {
+		return fmt.Errorf("logger not started")
+	}
+	dir := attachmentFolder(logFile)
+	path := filepath.Join(dir, hash)
+	// Content is addressed by its hash, so an existing file already has the same content
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(dir, toolio.Perm755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+hash+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Returns the attachment folder of a log file.
+//
+//	<UserDir>/log/app.log.json.1 -> <UserDir>/log/attachments/app.log.json.1
+func attachmentFolder(logFile string) string {
+	return filepath.Join(filepath.Dir(logFile), attachmentFolderName, filepath.Base(logFile))
+}
+
+// Adds the resolved file path to all attachment references of a log entry.
+func resolveAttachments(entry map[string]interface{}, dir string) {
+	for _, v := range entry {
+		group, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		_, isAttachment := group[attachmentKey].(string)
+		hash, hasHash := group[attachmentHashKey].(string)
+		if isAttachment && hasHash {
+			group[attachmentPathKey] = filepath.Join(dir, filepath.Base(hash))
+			continue
+		}
+		resolveAttachments(group, dir)
+	}
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachment(t *testing.T) {
+	discardStderr(t)
+	dir := t.TempDir()
+	err := Start(&Options{UserDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+	folder := attachmentFolder(logFile)
+
+	// Disabled levels must not store the payload
+	Log.Debug("Debug payload.", Attachment("body", []byte("debug")))
+	if _, err := os.Stat(folder); !os.IsNotExist(err) {
+		t.Fatalf("attachment folder exists after a disabled record: %v", err)
+	}
+
+	payload := bytes.Repeat([]byte("payload "), 100)
+	Log.Info("Request failed.", Attachment("body", payload))
+	Log.Info("Request failed again.", Attachment("body", payload))
+	files, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d attachment files, want 1", len(files))
+	}
+
+	logs, err := GetLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, l := range logs {
+		body, ok := l["body"].(map[string]any)
+		if !ok {
+			continue
+		}
+		found++
+		if body["size"] != float64(len(payload)) {
+			t.Errorf("size = %v, want %d", body["size"], len(payload))
+		}
+		data, err := os.ReadFile(body[attachmentPathKey].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, payload) {
+			t.Error("stored payload differs")
+		}
+		if filepath.Dir(body[attachmentPathKey].(string)) != folder {
+			t.Errorf("path = %v, want it in %s", body[attachmentPathKey], folder)
+		}
+	}
+	if found != 2 {
+		t.Errorf("got %d records with attachment, want 2", found)
+	}
+}
@@ -0,0 +1,115 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSyncInterval = time.Second
+
+type SyncMode int
+
+const (
+	SyncNone     SyncMode = iota // Leave flushing to the OS
+	SyncInterval                 // Fsync periodically, if something was written
+	SyncLevel                    // Fsync after every record at or above a level
+	SyncAlways                   // Fsync after every write
+)
+
+type DurabilityOptions struct {
+	Mode     SyncMode
+	Interval time.Duration // Fsync interval for SyncInterval. Defaults to 1s
+	Level    slog.Leveler  // Minimum level for SyncLevel. Defaults to ERROR
+}
+
+// Log file, which is synced to disk according to DurabilityOptions.
+type syncFile struct {
+	*os.File
+	mode  SyncMode
+	dirty atomic.Bool
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newSyncFile(f *os.File, opts DurabilityOptions) *syncFile {
+	s := &syncFile{File: f, mode: opts.Mode, done: make(chan struct{})}
+	if opts.Mode == SyncInterval {
+		interval := opts.Interval
+		if interval <= 0 {
+			interval = defaultSyncInterval
+		}
+		s.stopped.Add(1)
+		go s.syncPeriodically(interval)
+	}
+	return s
+}
+
+func (s *syncFile) Write(p []byte) (int, error) {
+	n, err := s.File.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if s.mode == SyncAlways {
+		return n, s.File.Sync()
+	}
+	s.dirty.Store(true)
+	return n, nil
+}
+
+// Syncs the file, if something was written since the last sync.
+func (s *syncFile) Sync() error {
+	if !s.dirty.Swap(false) {
+		return nil
+	}
+	return s.File.Sync()
+}
+
+func (s *syncFile) syncPeriodically(interval time.Duration) {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Sync()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Stops periodic syncing, syncs and closes the file.
+func (s *syncFile) Close() error {
+	close(s.done)
+	s.stopped.Wait()
+	s.Sync()
+	return s.File.Close()
+}
+
+// Syncs the log file after every record at or above a level.
+type syncLevelHandler struct {
+	slog.Handler
+	file  *syncFile
+	level slog.Leveler
+}
+
+func (h *syncLevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.Handler.Handle(ctx, r)
+	if err != nil || r.Level < h.level.Level() {
+		return err
+	}
+	return h.file.Sync()
+}
+
+func (h *syncLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syncLevelHandler{h.Handler.WithAttrs(attrs), h.file, h.level}
+}
+
+func (h *syncLevelHandler) WithGroup(name string) slog.Handler {
+	return &syncLevelHandler{h.Handler.WithGroup(name), h.file, h.level}
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Redirects os.Stderr to the null device, so Start doesn't print every record.
+func discardStderr(tb testing.TB) {
+	tb.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = null
+	tb.Cleanup(func() {
+		os.Stderr = stderr
+		null.Close()
+	})
+}
+
+// Measures the cost of each SyncMode for records below and at the SyncLevel threshold.
+func BenchmarkDurability(b *testing.B) {
+	modes := []struct {
+		name string
+		opts DurabilityOptions
+	}{
+		{"SyncNone", DurabilityOptions{Mode: SyncNone}},
+		{"SyncInterval", DurabilityOptions{Mode: SyncInterval, Interval: 100 * time.Millisecond}},
+		{"SyncLevel", DurabilityOptions{Mode: SyncLevel}},
+		{"SyncAlways", DurabilityOptions{Mode: SyncAlways}},
+	}
+	for _, m := range modes {
+		for _, level := range []struct {
+			name string
+			log  func(msg string, args ...any)
+		}{
+			{"info", func(msg string, args ...any) { Log.Info(msg, args...) }},
+			{"error", func(msg string, args ...any) { Log.Error(msg, args...) }},
+		} {
+			b.Run(m.name+"/"+level.name, func(b *testing.B) {
+				discardStderr(b)
+				err := Start(&Options{UserDir: b.TempDir(), Durability: m.opts})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer Stop()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := range b.N {
+					level.log("Benchmark record.", "i", i, "mode", m.name)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runs cmd and logs its output as structured records.
+//
+//	Every line of stdout is logged at INFO, every line of stderr at WARN,
+//	with the attributes `cmd`, `pid` and `stream`.
+//	Lines that are JSON records of a child using slog keep their level, message and attributes.
+//	On completion, the exit code and duration are logged.
+//	cmd.Stdout and cmd.Stderr must not be set.
+func Run(cmd *exec.Cmd) error {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:]) // skip [Callers, Run]
+	pc := pcs[0]
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = cmd.Start()
+	if err != nil {
+		logRecord(pc, LevelError, "Failed to start command.", "cmd", cmd.String(), "error", err)
+		return err
+	}
+	attrs := slices.Clip([]any{"cmd", cmd.String(), "pid", cmd.Process.Pid})
+
+	// Stream output, Wait closes the pipes, so all output has to be read first
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		logLines(pc, stdout, LevelInfo, append(attrs, "stream", "stdout"))
+	}()
+	go func() {
+		defer wg.Done()
+		logLines(pc, stderr, LevelWarn, append(attrs, "stream", "stderr"))
+	}()
+	wg.Wait()
+	err = cmd.Wait()
+
+	attrs = append(attrs, "exit code", cmd.ProcessState.ExitCode(), "duration", time.Since(start))
+	if err != nil {
+		logRecord(pc, LevelError, "Command failed.", append(attrs, "error", err)...)
+		return err
+	}
+	logRecord(pc, LevelInfo, "Command finished.", attrs...)
+	return nil
+}
+
+// Logs every line read from r.
+func logLines(pc uintptr, r io.Reader, level slog.Level, attrs []any) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxScanTokenSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if lineLevel, msg, childAttrs, ok := parseChildRecord(line); ok {
+			logRecord(pc, lineLevel, msg, append(attrs, childAttrs...)...)
+			continue
+		}
+		logRecord(pc, level, strings.TrimRight(line, "\r"), attrs...)
+	}
+	if err := scanner.Err(); err != nil {
+		logRecord(pc, LevelError, "Failed to read command output.", append(attrs, "error", err)...)
+		// Keep draining, so the child doesn't block on a full pipe
+		io.Copy(io.Discard, r)
+	}
+}
+
+// Parses a line written by a slog JSONHandler.
+// The child's time and source are kept as `child time` and `child source`.
+func parseChildRecord(line string) (slog.Level, string, []any, bool) {
+	if !strings.HasPrefix(line, "{") {
+		return 0, "", nil, false
+	}
+	record := make(map[string]any)
+	err := json.Unmarshal([]byte(line), &record)
+	if err != nil {
+		return 0, "", nil, false
+	}
+	levelName, ok := record[slog.LevelKey].(string)
+	if !ok {
+		return 0, "", nil, false
+	}
+	msg, ok := record[slog.MessageKey].(string)
+	if !ok {
+		return 0, "", nil, false
+	}
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return 0, "", nil, false
+	}
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]any, 0, 2*len(record))
+	for _, k := range keys {
+		v := record[k]
+		switch k {
+		case slog.LevelKey, slog.MessageKey:
+		case slog.TimeKey, slog.SourceKey:
+			attrs = append(attrs, "child "+k, v)
+		default:
+			attrs = append(attrs, k, v)
+		}
+	}
+	return level, msg, attrs, true
+}
+
+// Logs a record with the given source.
+func logRecord(pc uintptr, level slog.Level, msg string, args ...any) {
+	ctx := context.Background()
+	if Log == nil || !Log.Enabled(ctx, level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, msg, pc)
+	r.Add(args...)
+	Log.Handler().Handle(ctx, r)
+}
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const execChildEnv = "GOTOOL_LOG_TEST_CHILD"
+
+// Not a test: the child process of TestRun, started by re-executing the test binary.
+func TestExecChild(t *testing.T) {
+	if os.Getenv(execChildEnv) != "1" {
+		t.Skip("only runs as child of TestRun")
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}))
+	logger.Debug("child debug", "key", "value", slog.Group("g", "n", 1))
+	fmt.Println("plain stdout")
+	slog.New(slog.NewJSONHandler(os.Stderr, nil)).Error("child error", "error", "disk full")
+	fmt.Fprintln(os.Stderr, "plain stderr\r")
+	fmt.Fprintln(os.Stderr, `{"level":"INFO","msg":"malformed"`)
+	fmt.Fprintln(os.Stderr, `{"level":"LOUD","msg":"unknown level"}`)
+	fmt.Fprintln(os.Stderr, `{"msg":"no level"}`)
+	os.Exit(3)
+}
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+	prev := Log
+	Log = slog.New(newJSONHandler(&buf, LevelTrace, false, nil))
+	t.Cleanup(func() { Log = prev })
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExecChild$")
+	cmd.Env = append(os.Environ(), execChildEnv+"=1")
+	err := Run(cmd)
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("error = %v, want exit code 3", err)
+	}
+
+	records := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		err := json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			t.Fatalf("invalid record %s: %v", line, err)
+		}
+		if record["cmd"] != cmd.String() || record["pid"] != float64(cmd.Process.Pid) {
+			t.Errorf("record %s lacks the command", line)
+		}
+		records[record["msg"].(string)] = record
+	}
+
+	tests := []struct {
+		msg    string
+		level  string
+		stream string
+		attrs  map[string]any
+	}{
+		{"child debug", "DEBUG", "stdout", map[string]any{"key": "value", "g": map[string]any{"n": 1.0}}},
+		{"plain stdout", "INFO", "stdout", nil},
+		{"child error", "ERROR", "stderr", map[string]any{"error": "disk full"}},
+		{"plain stderr", "WARN", "stderr", nil},
+		{`{"level":"INFO","msg":"malformed"`, "WARN", "stderr", nil},
+		{`{"level":"LOUD","msg":"unknown level"}`, "WARN", "stderr", nil},
+		{`{"msg":"no level"}`, "WARN", "stderr", nil},
+		{"Command failed.", "ERROR", "", map[string]any{"exit code": 3.0, "error": "exit status 3"}},
+	}
+	for _, tt := range tests {
+		record, ok := records[tt.msg]
+		if !ok {
+			t.Errorf("no record %q in\n%s", tt.msg, buf.String())
+			continue
+		}
+		if record["level"] != tt.level || (tt.stream != "" && record["stream"] != tt.stream) {
+			t.Errorf("%q: level %v, stream %v, want %s, %s", tt.msg, record["level"], record["stream"], tt.level, tt.stream)
+		}
+		for k, v := range tt.attrs {
+			got, _ := json.Marshal(record[k])
+			want, _ := json.Marshal(v)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%q: %s = %s, want %s", tt.msg, k, got, want)
+			}
+		}
+	}
+	// The child's time and source don't replace the own ones
+	if r := records["child debug"]; r["child time"] == nil || r["child source"] == nil {
+		t.Errorf("child debug = %v, want child time and source", r)
+	}
+}
+
+func TestParseChildRecord(t *testing.T) {
+	tests := []struct {
+		line  string
+		ok    bool
+		level slog.Level
+		msg   string
+		attrs string // JSON of the attributes
+	}{
+		{`{"time":"t","level":"WARN+2","msg":"m","b":[1],"a":{"c":null}}`, true, slog.LevelWarn + 2, "m", `["a",{"c":null},"b",[1],"child time","t"]`},
+		{`{"level":"TRACE","msg":""}`, true, LevelTrace, "", `[]`},
+		{`plain`, false, 0, "", ``},
+		{`{"level":"INFO"}`, false, 0, "", ``},
+		{`{"level":1,"msg":"m"}`, false, 0, "", ``},
+		{`{"level":"INFO","msg":"m"} trailing`, false, 0, "", ``},
+		{`[1]`, false, 0, "", ``},
+	}
+	for _, tt := range tests {
+		level, msg, attrs, ok := parseChildRecord(tt.line)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v", tt.line, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		got, _ := json.Marshal(attrs)
+		if level != tt.level || msg != tt.msg || string(got) != tt.attrs {
+			t.Errorf("%s: got %v %q %s, want %v %q %s", tt.line, level, msg, got, tt.level, tt.msg, tt.attrs)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const maxPooledBufferSize = 16 << 10
+
+// JSON handler producing the same output as slog.JSONHandler with the level names and SourceOptions of this package.
+//
+//	Encoders are pooled, attributes added by WithAttrs are encoded only once
+//	and the rendered source of each call site is cached, so the handler doesn't allocate
+//	for records with scalar attributes. Writers and wrapping handlers may still allocate.
+//	Each record is passed to the writer with a single Write call.
+type jsonHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex // shared by all derived handlers
+	level  slog.Leveler
+	source *sourceCache // nil if sources are omitted
+
+	prefix []byte   // encoded attributes of WithAttrs, including opened groups
+	groups []string // all groups of WithGroup
+	nOpen  int      // number of groups opened in prefix
+}
+
+func newJSONHandler(w io.Writer, level slog.Leveler, addSource bool, sourceOpts *SourceOptions) *jsonHandler {
+	h := &jsonHandler{w: w, mu: &sync.Mutex{}, level: level}
+	if addSource {
+		h.source = &sourceCache{opts: sourceOpts, entries: make(map[uintptr][]byte)}
+	}
+	return h
+}
+
+func (h *jsonHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *jsonHandler) Handle(_ context.Context, r slog.Record) error {
+	e := encoderPool.Get().(*recordEncoder)
+	defer e.free()
+
+	e.buf = append(e.buf, '{')
+	if !r.Time.IsZero() {
+		e.key(slog.TimeKey)
+		e.time(r.Time.Round(0))
+	}
+	e.key(slog.LevelKey)
+	e.string(LevelName(r.Level))
+	if h.source != nil && r.PC != 0 {
+		if src := h.source.get(r.PC); len(src) > 0 {
+			e.buf = append(e.buf, e.sep...)
+			e.buf = append(e.buf, src...)
+			e.sep = ","
+		}
+	}
+	e.key(slog.MessageKey)
+	e.string(r.Message)
+
+	if len(h.prefix) > 0 {
+		e.buf = append(e.buf, e.sep...)
+		e.buf = append(e.buf, h.prefix...)
+		e.sep = ","
+		if h.prefix[len(h.prefix)-1] == '{' {
+			e.sep = ""
+		}
+	}
+	nOpen := h.nOpen
+	if r.NumAttrs() > 0 {
+		pos, sep := len(e.buf), e.sep
+		for _, g := range h.groups[h.nOpen:] {
+			e.openGroup(g)
+		}
+		e.empty = true
+		r.Attrs(e.appendAttr)
+		if e.empty {
+			e.buf, e.sep = e.buf[:pos], sep
+		} else {
+			nOpen = len(h.groups)
+		}
+	}
+	for range nOpen {
+		e.buf = append(e.buf, '}')
+	}
+	e.buf = append(e.buf, '}', '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(e.buf)
+	return err
+}
+
+func (h *jsonHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	e := jsonEncoder{buf: h2.prefix}
+	if len(e.buf) > 0 && e.buf[len(e.buf)-1] != '{' {
+		e.sep = ","
+	}
+	for _, g := range h2.groups[h2.nOpen:] {
+		e.openGroup(g)
+	}
+	empty := true
+	for _, a := range attrs {
+		if e.attr(a) {
+			empty = false
+		}
+	}
+	if empty {
+		return h
+	}
+	h2.prefix = e.buf[:len(e.buf):len(e.buf)]
+	h2.nOpen = len(h2.groups)
+	return h2
+}
+
+func (h *jsonHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *jsonHandler) clone() *jsonHandler {
+	h2 := *h
+	h2.prefix = slices.Clip(h.prefix)
+	h2.groups = slices.Clip(h.groups)
+	return &h2
+}
+
+// Encoder of a single record.
+type recordEncoder struct {
+	jsonEncoder
+	empty      bool                 // no attribute of the record was written
+	appendAttr func(slog.Attr) bool // passed to Record.Attrs. Created once per encoder, so it doesn't allocate per record
+}
+
+var encoderPool = sync.Pool{New: func() any {
+	e := &recordEncoder{}
+	e.buf = make([]byte, 0, 1024)
+	e.appendAttr = func(a slog.Attr) bool {
+		if e.attr(a) {
+			e.empty = false
+		}
+		return true
+	}
+	return e
+}}
+
+func (e *recordEncoder) free() {
+	// Don't keep huge buffers around
+	if cap(e.buf) <= maxPooledBufferSize {
+		e.buf, e.sep = e.buf[:0], ""
+		encoderPool.Put(e)
+	}
+}
+
+// Caches the encoded `"source":{...}` of each call site.
+type sourceCache struct {
+	opts    *SourceOptions
+	mu      sync.RWMutex
+	entries map[uintptr][]byte
+}
+
+func (c *sourceCache) get(pc uintptr) []byte {
+	c.mu.RLock()
+	src, ok := c.entries[pc]
+	c.mu.RUnlock()
+	if ok {
+		return src
+	}
+
+	frames := runtime.CallersFrames([]uintptr{pc})
+	f, _ := frames.Next()
+	a := slog.Any(slog.SourceKey, &slog.Source{Function: f.Function, File: f.File, Line: f.Line})
+	if c.opts != nil {
+		a = c.opts.replaceAttr(nil, a)
+	}
+	e := jsonEncoder{}
+	e.attr(a)
+
+	c.mu.Lock()
+	c.entries[pc] = e.buf
+	c.mu.Unlock()
+	return e.buf
+}
+
+// Appends JSON to buf, the same way slog.JSONHandler does.
+type jsonEncoder struct {
+	buf []byte
+	sep string // separator to write before the next key
+}
+
+func (e *jsonEncoder) key(k string) {
+	e.buf = append(e.buf, e.sep...)
+	e.string(k)
+	e.buf = append(e.buf, ':')
+	e.sep = ","
+}
+
+func (e *jsonEncoder) openGroup(name string) {
+	e.key(name)
+	e.buf = append(e.buf, '{')
+	e.sep = ""
+}
+
+// Appends an attribute and reports whether anything was written.
+func (e *jsonEncoder) attr(a slog.Attr) bool {
+	a.Value = a.Value.Resolve()
+	if a.Key == "" && a.Value.Equal(slog.Value{}) {
+		return false
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			if src == nil || *src == (slog.Source{}) {
+				return false
+			}
+			a.Value = sourceGroup(src)
+		}
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		e.key(a.Key)
+		e.value(a.Value)
+		return true
+	}
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return false
+	}
+	pos, sep := len(e.buf), e.sep
+	if a.Key != "" {
+		e.openGroup(a.Key)
+	}
+	empty := true
+	for _, ga := range attrs {
+		if e.attr(ga) {
+			empty = false
+		}
+	}
+	if empty {
+		e.buf, e.sep = e.buf[:pos], sep
+		return false
+	}
+	if a.Key != "" {
+		e.buf = append(e.buf, '}')
+		e.sep = ","
+	}
+	return true
+}
+
+func (e *jsonEncoder) value(v slog.Value) {
+	switch v.Kind() {
+	case slog.KindString:
+		e.string(v.String())
+	case slog.KindInt64:
+		e.buf = strconv.AppendInt(e.buf, v.Int64(), 10)
+	case slog.KindUint64:
+		e.buf = strconv.AppendUint(e.buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		e.float(v.Float64())
+	case slog.KindBool:
+		e.buf = strconv.AppendBool(e.buf, v.Bool())
+	case slog.KindDuration:
+		e.buf = strconv.AppendInt(e.buf, int64(v.Duration()), 10)
+	case slog.KindTime:
+		e.time(v.Time())
+	default:
+		e.any(v)
+	}
+}
+
+// Appends a value of KindAny. Panics of its methods are written as the value, like slog.JSONHandler does.
+func (e *jsonEncoder) any(v slog.Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rv := reflect.ValueOf(v.Any()); rv.Kind() == reflect.Pointer && rv.IsNil() {
+				e.string("<nil>")
+				return
+			}
+			e.string(fmt.Sprintf("!PANIC: %v", r))
+		}
+	}()
+
+	a := v.Any()
+	_, jm := a.(json.Marshaler)
+	if err, ok := a.(error); ok && !jm {
+		e.string(err.Error())
+	} else {
+		e.marshal(a)
+	}
+}
+
+func (e *jsonEncoder) time(t time.Time) {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		e.error(errors.New("time.Time year outside of range [0,9999]"))
+		return
+	}
+	e.buf = append(e.buf, '"')
+	e.buf = t.AppendFormat(e.buf, time.RFC3339Nano)
+	e.buf = append(e.buf, '"')
+}
+
+// Formats floats like encoding/json.
+func (e *jsonEncoder) float(f float64) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		e.marshal(f)
+		return
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	e.buf = strconv.AppendFloat(e.buf, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		n := len(e.buf)
+		if n >= 4 && e.buf[n-4] == 'e' && e.buf[n-3] == '-' && e.buf[n-2] == '0' {
+			e.buf[n-2] = e.buf[n-1]
+			e.buf = e.buf[:n-1]
+		}
+	}
+}
+
+type marshalEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var marshalPool = sync.Pool{New: func() any {
+	m := &marshalEncoder{}
+	m.enc = json.NewEncoder(&m.buf)
+	m.enc.SetEscapeHTML(false)
+	return m
+}}
+
+func (e *jsonEncoder) marshal(v any) {
+	m := marshalPool.Get().(*marshalEncoder)
+	defer func() {
+		if m.buf.Cap() <= maxPooledBufferSize {
+			m.buf.Reset()
+			marshalPool.Put(m)
+		}
+	}()
+	err := m.enc.Encode(v)
+	if err != nil {
+		e.error(err)
+		return
+	}
+	b := m.buf.Bytes()
+	e.buf = append(e.buf, b[:len(b)-1]...) // remove final newline
+}
+
+func (e *jsonEncoder) error(err error) {
+	e.string(fmt.Sprintf("!ERROR:%v", err))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// Appends a quoted and escaped JSON string.
+func (e *jsonEncoder) string(s string) {
+	b := append(e.buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 is replaced, like encoding/json does
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	e.buf = append(b, '"')
+}
+
+func sourceGroup(src *slog.Source) slog.Value {
+	var attrs []slog.Attr
+	if src.Function != "" {
+		attrs = append(attrs, slog.String("function", src.Function))
+	}
+	if src.File != "" {
+		attrs = append(attrs, slog.String("file", src.File))
+	}
+	if src.Line != 0 {
+		attrs = append(attrs, slog.Int("line", src.Line))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Writes to all writers, even if some of them fail.
+type multiWriter []io.Writer
+
+func (w multiWriter) Write(p []byte) (int, error) {
+	var errs []error
+	for _, wr := range w {
+		_, err := wr.Write(p)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type marshaler struct{}
+
+func (marshaler) MarshalJSON() ([]byte, error) { return []byte(`{"custom":true}`), nil }
+
+type jsonError struct{}
+
+func (e jsonError) Error() string                { return "json error" }
+func (e jsonError) MarshalJSON() ([]byte, error) { return []byte(`{"code":1}`), nil }
+
+type panicStringer struct{ s *string }
+
+func (p panicStringer) MarshalJSON() ([]byte, error) { return []byte(`"` + *p.s + `"`), nil }
+
+type valuer struct{}
+
+func (valuer) LogValue() slog.Value { return slog.GroupValue(slog.String("a", "b")) }
+
+type testError struct{}
+
+func (*testError) Error() string { return "test error" }
+
+func TestJSONHandlerMatchesSlog(t *testing.T) {
+	var nilErr *testError
+	tests := []struct {
+		name   string
+		derive func(slog.Handler) slog.Handler
+		level  slog.Level
+		msg    string
+		attrs  []slog.Attr
+	}{
+		{name: "empty", msg: ""},
+		{name: "levels", level: slog.LevelError, msg: "error", attrs: []slog.Attr{slog.Any("level", slog.LevelWarn)}},
+		{name: "debug", level: slog.LevelDebug, msg: "debug"},
+		{name: "escaping", msg: "quote \" backslash \\ tab \t newline \n cr \r ctrl \x01 \x7f html <&> invalid \xff line sep \u2028 para sep \u2029 unicode äö€😀",
+			attrs: []slog.Attr{slog.String("key \"with\" quotes\n", "value\x00")}},
+		{name: "scalars", msg: "scalars", attrs: []slog.Attr{
+			slog.Int("int", -42), slog.Uint64("uint", math.MaxUint64), slog.Bool("bool", true),
+			slog.Duration("duration", 1500*time.Millisecond), slog.Time("time", time.Date(2024, 5, 1, 14, 3, 12, 123456789, time.FixedZone("", 2*60*60))),
+		}},
+		{name: "floats", msg: "floats", attrs: []slog.Attr{
+			slog.Float64("zero", 0), slog.Float64("negzero", math.Copysign(0, -1)), slog.Float64("small", 1e-7), slog.Float64("tiny", 1.5e-300),
+			slog.Float64("big", 1e21), slog.Float64("almost", 1e20), slog.Float64("pi", math.Pi), slog.Float64("max", math.MaxFloat64),
+			slog.Float64("nan", math.NaN()), slog.Float64("inf", math.Inf(1)),
+		}},
+		{name: "any", msg: "any", attrs: []slog.Attr{
+			slog.Any("map", map[string]any{"b": 1, "a": []int{1, 2}, "html": "<&>"}), slog.Any("struct", struct{ A, b int }{1, 2}),
+			slog.Any("marshaler", marshaler{}), slog.Any("nil", nil), slog.Any("bytes", []byte("abc")),
+			slog.Any("chan", make(chan int)), slog.Any("func", func() {}),
+		}},
+		{name: "errors", msg: "errors", attrs: []slog.Attr{
+			slog.Any("error", errors.New("boom")), slog.Any("json error", jsonError{}), slog.Any("nil error", nilErr),
+			slog.Any("panic", panicStringer{}),
+		}},
+		{name: "time out of range", msg: "time", attrs: []slog.Attr{slog.Time("time", time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC))}},
+		{name: "groups", msg: "groups", attrs: []slog.Attr{
+			slog.Group("g", slog.Int("a", 1), slog.Group("h", slog.Int("b", 2))),
+			slog.Group("empty"), slog.Group("", slog.Int("inline", 3)), slog.Group("g2", slog.Group("empty")),
+			slog.Any("valuer", valuer{}), slog.Attr{},
+		}},
+		{name: "with attrs", msg: "with", attrs: []slog.Attr{slog.Int("c", 3)},
+			derive: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.Int("a", 1)}).WithGroup("g").WithAttrs([]slog.Attr{slog.Int("b", 2)}).WithGroup("h")
+			}},
+		{name: "open group without attrs", msg: "open",
+			derive: func(h slog.Handler) slog.Handler { return h.WithGroup("g").WithAttrs([]slog.Attr{slog.Group("empty")}) }},
+		{name: "group with empty attrs", msg: "empty", attrs: []slog.Attr{slog.Group("empty")},
+			derive: func(h slog.Handler) slog.Handler { return h.WithGroup("g") }},
+		{name: "with empty attrs", msg: "empty",
+			derive: func(h slog.Handler) slog.Handler { return h.WithAttrs(nil).WithGroup("") }},
+	}
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pc := range []uintptr{0, pcs[0]} {
+				var want, got bytes.Buffer
+				var wantH slog.Handler = slog.NewJSONHandler(&want, &slog.HandlerOptions{AddSource: true, Level: LevelTrace})
+				var gotH slog.Handler = newJSONHandler(&got, LevelTrace, true, nil)
+				if tt.derive != nil {
+					wantH, gotH = tt.derive(wantH), tt.derive(gotH)
+				}
+				r := slog.NewRecord(time.Date(2024, 5, 1, 14, 3, 12, 5, time.UTC), tt.level, tt.msg, pc)
+				r.AddAttrs(tt.attrs...)
+				wantErr := wantH.Handle(context.Background(), r)
+				gotErr := gotH.Handle(context.Background(), r)
+				if (wantErr == nil) != (gotErr == nil) {
+					t.Fatalf("error = %v, want %v", gotErr, wantErr)
+				}
+				if got.String() != want.String() {
+					t.Errorf("output mismatch\n got: %s\nwant: %s", got.String(), want.String())
+				}
+			}
+		})
+	}
+}
+
+func TestJSONHandlerAllocs(t *testing.T) {
+	if testing.CoverMode() != "" {
+		t.Skip("coverage instrumentation allocates")
+	}
+	h := newJSONHandler(io.Discard, LevelInfo, true, &SourceOptions{Format: SourceBase})
+	l := slog.New(h.WithAttrs([]slog.Attr{slog.String("component", "test")}))
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		l.LogAttrs(ctx, LevelInfo, "hello", slog.Int("n", 1), slog.String("s", "x"), slog.Bool("b", true), slog.Duration("d", time.Second))
+	})
+	if allocs != 0 {
+		t.Errorf("allocs per record = %v, want 0", allocs)
+	}
+}
+
+// Compares the handler of Start with slog.JSONHandler writing to the same writers.
+func BenchmarkJSONHandler(b *testing.B) {
+	handlers := []struct {
+		name    string
+		handler slog.Handler
+	}{
+		{"gotool", newJSONHandler(multiWriter{io.Discard, io.Discard}, LevelInfo, true, nil)},
+		{"slog", slog.NewJSONHandler(io.MultiWriter(io.Discard, io.Discard), &slog.HandlerOptions{AddSource: true, Level: LevelInfo})},
+	}
+	for _, h := range handlers {
+		b.Run(h.name+"/scalars", func(b *testing.B) {
+			l := slog.New(h.handler)
+			ctx := context.Background()
+			b.ReportAllocs()
+			for range b.N {
+				l.LogAttrs(ctx, LevelInfo, "hello", slog.Int("n", 1), slog.String("s", "x"))
+			}
+		})
+		b.Run(h.name+"/with attrs", func(b *testing.B) {
+			l := slog.New(h.handler).With("request", "abc", "user", 42).WithGroup("g")
+			ctx := context.Background()
+			b.ReportAllocs()
+			for range b.N {
+				l.LogAttrs(ctx, LevelInfo, "hello", slog.Int("n", 1), slog.String("s", "x"))
+			}
+		})
+		b.Run(h.name+"/any", func(b *testing.B) {
+			l := slog.New(h.handler)
+			ctx := context.Background()
+			m := map[string]int{"a": 1, "b": 2}
+			b.ReportAllocs()
+			for range b.N {
+				l.LogAttrs(ctx, LevelInfo, "hello", slog.Any("map", m), slog.Any("error", io.EOF))
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	LevelTrace  = slog.Level(-8)
+	LevelDebug  = slog.LevelDebug
+	LevelInfo   = slog.LevelInfo
+	LevelNotice = slog.Level(2)
+	LevelWarn   = slog.LevelWarn
+	LevelError  = slog.LevelError
+	LevelFatal  = slog.Level(12)
+)
+
+// Levels ordered by severity, used for names and the level flags in GetLogs.
+var levels = []slog.Level{LevelTrace, LevelDebug, LevelInfo, LevelNotice, LevelWarn, LevelError, LevelFatal}
+
+var levelNames = map[slog.Level]string{
+	LevelTrace:  "TRACE",
+	LevelDebug:  "DEBUG",
+	LevelInfo:   "INFO",
+	LevelNotice: "NOTICE",
+	LevelWarn:   "WARN",
+	LevelError:  "ERROR",
+	LevelFatal:  "FATAL",
+}
+
+var exit = os.Exit
+
+// Returns the name of a level.
+//
+//	Levels between the named ones are rendered relative to the next lower one, e.g. `NOTICE+1`.
+func LevelName(l slog.Level) string {
+	base := levels[0]
+	for _, lvl := range levels {
+		if lvl <= l {
+			base = lvl
+		}
+	}
+	name := levelNames[base]
+	if l == base {
+		return name
+	}
+	return fmt.Sprintf("%s%+d", name, l-base)
+}
+
+// Parses a level name like `notice`, `TRACE` or `WARN+2`.
+func ParseLevel(s string) (slog.Level, error) {
+	name, offset := strings.ToUpper(strings.TrimSpace(s)), ""
+	if i := strings.IndexAny(name, "+-"); i > 0 {
+		name, offset = name[:i], name[i:]
+	}
+	for _, l := range levels {
+		if levelNames[l] != name {
+			continue
+		}
+		if offset == "" {
+			return l, nil
+		}
+		var n int
+		_, err := fmt.Sscanf(offset, "%d", &n)
+		if err != nil {
+			return 0, fmt.Errorf("invalid level %q: %w", s, err)
+		}
+		return l + slog.Level(n), nil
+	}
+	return 0, fmt.Errorf("unknown level %q", s)
+}
+
+// Logs at TRACE level.
+func Trace(msg string, args ...any) {
+	logAt(LevelTrace, msg, args...)
+}
+
+// Logs at NOTICE level.
+func Notice(msg string, args ...any) {
+	logAt(LevelNotice, msg, args...)
+}
+
+// Logs at FATAL level and terminates the program.
+//
+//	All sinks are flushed before exiting with status 1.
+//	If Options.NotifyFatal is set, the user is notified first.
+//	The program exits as soon as it returns, so it must wait for the notification,
+//	e.g. with notify.NotifyOS instead of notify.NotifyOSAsync.
+func Fatal(msg string, args ...any) {
+	logAt(LevelFatal, msg, args...)
+	if notifyFatal != nil {
+		notifyFatal(msg)
+	}
+	Stop()
+	exit(1)
+}
+
+// Logs a record with the caller of the exported function as source.
+func logAt(level slog.Level, msg string, args ...any) {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip [Callers, logAt, Trace/Notice/Fatal]
+	logRecord(pcs[0], level, msg, args...)
+}
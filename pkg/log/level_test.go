@@ -0,0 +1,60 @@
+package log
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFatal(t *testing.T) {
+	discardStderr(t)
+	dir := t.TempDir()
+	// Failing uploads keep the shipped records in the spool
+	endpoint, _ := shipEndpoint(t, func(int) int { return http.StatusServiceUnavailable })
+	var steps []string
+	err := Start(&Options{
+		UserDir:     dir,
+		Ship:        &ShipOptions{Endpoint: endpoint, BatchSize: 100, FlushInterval: time.Hour, MinBackoff: time.Hour},
+		NotifyFatal: func(message string) { steps = append(steps, "notify "+message) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+
+	prev := exit
+	t.Cleanup(func() { exit = prev })
+	exit = func(code int) {
+		steps = append(steps, "exit")
+		if code != 1 {
+			t.Errorf("exit code %d, want 1", code)
+		}
+		data, err := os.ReadFile(logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`"level":"FATAL"`, `"msg":"Cannot continue."`, `"function":"github.com/johannes-luebke/gotool/pkg/log.TestFatal"`} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("log file lacks %s before exit:\n%s", want, data)
+			}
+		}
+		// The batch is only written to the spool by Stop
+		spool, _ := filepath.Glob(filepath.Join(logFolder, "spool", "*"))
+		var shipped string
+		for _, name := range spool {
+			data, _ := os.ReadFile(name)
+			shipped += string(data)
+		}
+		if !strings.Contains(shipped, "Cannot continue.") {
+			t.Errorf("spool %v lacks the record before exit", spool)
+		}
+	}
+
+	Fatal("Cannot continue.", "reason", "test")
+	if got := strings.Join(steps, ", "); got != "notify Cannot continue., exit" {
+		t.Errorf("steps = %s, want notify, exit", got)
+	}
+}
@@ -0,0 +1,221 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	truncatedKey     = "!TRUNCATED" // Number of attributes dropped due to the record size limit
+	maxScanTokenSize = 64 << 20     // Longest log line GetLogs can read
+)
+
+// Size limits for log records. A limit of 0 disables the check.
+type LimitOptions struct {
+	MaxValueSize  int // Maximum size of a single attribute value in bytes
+	MaxRecordSize int // Approximate maximum size of a record in bytes. Attributes beyond the limit are dropped
+	MaxLen        int // Maximum number of elements of slices, arrays and maps
+	MaxDepth      int // Maximum nesting depth of groups
+}
+
+// Applies LimitOptions to every record.
+//
+//	Truncated values are marked with `…[<n> bytes truncated]` or `…[<n> more]`.
+//	Groups beyond MaxDepth are replaced by `[max depth]`.
+//	If the record exceeds MaxRecordSize, the remaining attributes are dropped and counted in `!TRUNCATED`.
+type limitHandler struct {
+	slog.Handler
+	opts  *LimitOptions
+	depth int // nesting depth of WithGroup calls
+	size  int // approximate size of the attributes added by WithAttrs
+}
+
+func (h *limitHandler) Handle(ctx context.Context, r slog.Record) error {
+	size := h.size
+	msg := r.Message
+	if h.opts.MaxRecordSize > 0 && len(msg) > h.opts.MaxRecordSize {
+		msg = truncateString(msg, h.opts.MaxRecordSize)
+		metrics.truncatedAttrs.Add(1)
+	}
+	size += len(msg)
+
+	nr := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+	dropped := 0
+	r.Attrs(func(a slog.Attr) bool {
+		if dropped > 0 {
+			dropped++
+			return true
+		}
+		a = h.limitAttr(a, h.depth)
+		attrSize := sizeOfAttr(a)
+		if h.opts.MaxRecordSize > 0 && size+attrSize > h.opts.MaxRecordSize {
+			dropped++
+			return true
+		}
+		size += attrSize
+		nr.AddAttrs(a)
+		return true
+	})
+	if dropped > 0 {
+		nr.AddAttrs(slog.Int(truncatedKey, dropped))
+		metrics.truncatedAttrs.Add(uint64(dropped))
+		metrics.truncatedRecords.Add(1)
+	}
+	return h.Handler.Handle(ctx, nr)
+}
+
+func (h *limitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	limited := make([]slog.Attr, len(attrs))
+	size := h.size
+	for i, a := range attrs {
+		limited[i] = h.limitAttr(a, h.depth)
+		size += sizeOfAttr(limited[i])
+	}
+	return &limitHandler{h.Handler.WithAttrs(limited), h.opts, h.depth, size}
+}
+
+func (h *limitHandler) WithGroup(name string) slog.Handler {
+	return &limitHandler{h.Handler.WithGroup(name), h.opts, h.depth + 1, h.size + len(name)}
+}
+
+// Applies the value, length and depth limits to a single attribute.
+func (h *limitHandler) limitAttr(a slog.Attr, depth int) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); h.opts.MaxValueSize > 0 && len(s) > h.opts.MaxValueSize {
+			a.Value = slog.StringValue(truncateString(s, h.opts.MaxValueSize))
+			metrics.truncatedAttrs.Add(1)
+		}
+	case slog.KindGroup:
+		if h.opts.MaxDepth > 0 && depth >= h.opts.MaxDepth {
+			a.Value = slog.StringValue("[max depth]")
+			metrics.truncatedAttrs.Add(1)
+			return a
+		}
+		group := a.Value.Group()
+		limited := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			limited[i] = h.limitAttr(ga, depth+1)
+		}
+		a.Value = slog.GroupValue(limited...)
+	case slog.KindAny:
+		a.Value = h.limitAny(a.Value.Any())
+	}
+	return a
+}
+
+// Limits slices, arrays and maps to MaxLen elements
+// and replaces values exceeding MaxValueSize by their truncated JSON encoding.
+// Like jsonEncoder.any, it never panics on nil pointers or panicking methods.
+func (h *limitHandler) limitAny(v any) (limited slog.Value) {
+	original := v
+	defer func() {
+		if r := recover(); r != nil {
+			if rv := reflect.ValueOf(original); rv.Kind() == reflect.Pointer && rv.IsNil() {
+				limited = slog.AnyValue(original)
+				return
+			}
+			limited = slog.StringValue(fmt.Sprintf("!PANIC: %v", r))
+		}
+	}()
+
+	truncated := false
+	if err, ok := v.(error); ok {
+		if _, jm := v.(json.Marshaler); !jm {
+			v = err.Error()
+		}
+	}
+	if h.opts.MaxLen > 0 {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			if rv.Type().Elem().Kind() != reflect.Uint8 && rv.Len() > h.opts.MaxLen {
+				elems := make([]any, 0, h.opts.MaxLen+1)
+				for i := 0; i < h.opts.MaxLen; i++ {
+					elems = append(elems, rv.Index(i).Interface())
+				}
+				elems = append(elems, fmt.Sprintf("…[%d more]", rv.Len()-h.opts.MaxLen))
+				v, truncated = elems, true
+			}
+		case reflect.Map:
+			if rv.Len() > h.opts.MaxLen {
+				// Keep the first keys in the order they are encoded in
+				keys := make([]string, 0, rv.Len())
+				values := make(map[string]any, rv.Len())
+				for it := rv.MapRange(); it.Next(); {
+					k := fmt.Sprint(it.Key().Interface())
+					keys = append(keys, k)
+					values[k] = it.Value().Interface()
+				}
+				sort.Strings(keys)
+				m := make(map[string]any, h.opts.MaxLen+1)
+				for _, k := range keys[:h.opts.MaxLen] {
+					m[k] = values[k]
+				}
+				m["…"] = fmt.Sprintf("[%d more]", rv.Len()-h.opts.MaxLen)
+				v, truncated = m, true
+			}
+		}
+	}
+	if h.opts.MaxValueSize > 0 {
+		if s, ok := v.(string); ok {
+			if len(s) > h.opts.MaxValueSize {
+				v, truncated = truncateString(s, h.opts.MaxValueSize), true
+			}
+		} else if b, err := marshal(v); err == nil && len(b) > h.opts.MaxValueSize {
+			v, truncated = truncateString(string(b), h.opts.MaxValueSize), true
+		}
+	}
+	if truncated {
+		metrics.truncatedAttrs.Add(1)
+	}
+	return slog.AnyValue(v)
+}
+
+// Cuts s to at most n bytes without splitting a UTF-8 sequence and appends a truncation marker.
+func truncateString(s string, n int) string {
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s…[%d bytes truncated]", s[:cut], len(s)-cut)
+}
+
+// Returns the approximate encoded size of an attribute.
+func sizeOfAttr(a slog.Attr) int {
+	size := len(a.Key) + 4 // quotes, colon and comma
+	switch a.Value.Kind() {
+	case slog.KindString:
+		size += len(a.Value.String()) + 2
+	case slog.KindGroup:
+		size += 2
+		for _, ga := range a.Value.Group() {
+			size += sizeOfAttr(ga)
+		}
+	case slog.KindAny:
+		if b, err := marshal(a.Value.Any()); err == nil {
+			size += len(b)
+		} else {
+			size += len(a.Value.String())
+		}
+	default:
+		size += len(a.Value.String())
+	}
+	return size
+}
+
+// Like json.Marshal, but returns panics of MarshalJSON methods as errors.
+func marshal(v any) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("!PANIC: %v", r)
+		}
+	}()
+	return json.Marshal(v)
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+type panicMarshaler struct{}
+
+func (panicMarshaler) MarshalJSON() ([]byte, error) { panic("boom") }
+
+// Returns a logger applying opts, and a function decoding the last record.
+func newLimitLogger(t *testing.T, opts LimitOptions) (*slog.Logger, func() map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := slog.New(&limitHandler{Handler: newJSONHandler(&buf, LevelTrace, false, nil), opts: &opts})
+	last := func() map[string]any {
+		t.Helper()
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		var record map[string]any
+		err := json.Unmarshal([]byte(lines[len(lines)-1]), &record)
+		if err != nil {
+			t.Fatalf("invalid record %s: %v", lines[len(lines)-1], err)
+		}
+		delete(record, "time")
+		delete(record, "level")
+		return record
+	}
+	return l, last
+}
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"abcdef", 3, "abc…[3 bytes truncated]"},
+		{"abcdef", 0, "…[6 bytes truncated]"},
+		// "ä" is 2 bytes and "€" 3, neither is split
+		{"aäb", 2, "a…[3 bytes truncated]"},
+		{"a€b", 2, "a…[4 bytes truncated]"},
+		{"a€b", 3, "a…[4 bytes truncated]"},
+		{"a€b", 4, "a€…[1 bytes truncated]"},
+		{"😀😀", 5, "😀…[4 bytes truncated]"},
+	}
+	for _, tt := range tests {
+		if got := truncateString(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncateString(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLimitValues(t *testing.T) {
+	tests := []struct {
+		opts  LimitOptions
+		value any
+		want  string // JSON
+	}{
+		{LimitOptions{MaxValueSize: 8}, "ok", `"ok"`},
+		{LimitOptions{MaxValueSize: 8}, "0123456789", `"01234567…[2 bytes truncated]"`},
+		{LimitOptions{MaxValueSize: 8}, "abcdefgä€", `"abcdefg…[5 bytes truncated]"`},
+		{LimitOptions{MaxValueSize: 8}, errors.New("0123456789"), `"01234567…[2 bytes truncated]"`},
+		{LimitOptions{MaxValueSize: 8}, struct{ Text string }{"0123456789"}, `"{\"Text\":…[13 bytes truncated]"`},
+		{LimitOptions{MaxValueSize: 8}, []int{1, 2}, `[1,2]`},
+		{LimitOptions{MaxLen: 2}, []int{1, 2, 3, 4}, `[1,2,"…[2 more]"]`},
+		{LimitOptions{MaxLen: 2}, [3]string{"a", "b", "c"}, `["a","b","…[1 more]"]`},
+		{LimitOptions{MaxLen: 2}, []byte("abc"), `"YWJj"`},
+		{LimitOptions{MaxLen: 2}, map[string]int{"c": 3, "a": 1, "b": 2}, `{"a":1,"b":2,"…":"[1 more]"}`},
+		{LimitOptions{MaxLen: 2}, map[int]bool{1: true}, `{"1":true}`},
+		{LimitOptions{MaxLen: 2, MaxValueSize: 8}, []int{1, 2, 3}, `"[1,2,\"…[13 bytes truncated]"`},
+	}
+	for _, tt := range tests {
+		l, last := newLimitLogger(t, tt.opts)
+		l.Info("values", "v", tt.value)
+		got, _ := json.Marshal(last()["v"])
+		if string(got) != tt.want {
+			t.Errorf("%+v: %#v = %s, want %s", tt.opts, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLimitDepth(t *testing.T) {
+	l, last := newLimitLogger(t, LimitOptions{MaxDepth: 2})
+	l.Info("depth", slog.Group("a", slog.Int("x", 1), slog.Group("b", slog.Int("y", 2), slog.Group("c", slog.Int("z", 3)))))
+	got, _ := json.Marshal(last()["a"])
+	if want := `{"b":{"c":"[max depth]","y":2},"x":1}`; string(got) != want {
+		t.Errorf("a = %s, want %s", got, want)
+	}
+
+	// WithGroup counts towards the depth
+	l.WithGroup("g").Info("depth", slog.Group("a", slog.Group("b", slog.Int("y", 2))))
+	got, _ = json.Marshal(last()["g"])
+	if want := `{"a":{"b":"[max depth]"}}`; string(got) != want {
+		t.Errorf("g = %s, want %s", got, want)
+	}
+	l.WithGroup("g").WithGroup("h").Info("depth", slog.Group("a", slog.Int("x", 1)))
+	got, _ = json.Marshal(last()["g"])
+	if want := `{"h":{"a":"[max depth]"}}`; string(got) != want {
+		t.Errorf("g = %s, want %s", got, want)
+	}
+}
+
+func TestLimitRecordSize(t *testing.T) {
+	l, last := newLimitLogger(t, LimitOptions{MaxRecordSize: 40})
+	before := GetMetrics()
+	l.Info("record", "a", "0123456789", "b", "0123456789", "c", "0123456789", "d", 1)
+	record := last()
+	if record["a"] != "0123456789" || record["b"] != "0123456789" {
+		t.Errorf("kept %v, want the first attributes", record)
+	}
+	if _, ok := record["c"]; ok {
+		t.Errorf("record %v exceeds the limit", record)
+	}
+	if record[truncatedKey] != 2.0 {
+		t.Errorf("%s = %v, want 2", truncatedKey, record[truncatedKey])
+	}
+	after := GetMetrics()
+	if after.TruncatedRecords-before.TruncatedRecords != 1 || after.TruncatedAttrs-before.TruncatedAttrs != 2 {
+		t.Errorf("metrics = %+v, before %+v", after, before)
+	}
+
+	// Attributes of WithAttrs count towards the size
+	l.With("w", strings.Repeat("x", 30)).Info("record", "a", "0123456789")
+	if record := last(); record[truncatedKey] != 1.0 {
+		t.Errorf("record %v, want a dropped", record)
+	}
+
+	// A long message is cut to the limit
+	l.Info(strings.Repeat("m", 50))
+	if msg := last()["msg"].(string); !strings.HasPrefix(msg, strings.Repeat("m", 40)+"…[10 bytes") {
+		t.Errorf("msg = %q", msg)
+	}
+}
+
+func TestLimitNilAndPanics(t *testing.T) {
+	var pathErr *os.PathError
+	var nilMap map[string]int
+	for _, opts := range []LimitOptions{{MaxValueSize: 8}, {MaxLen: 1}, {MaxRecordSize: 1000}} {
+		l, last := newLimitLogger(t, opts)
+		l.Info("nil", "error", pathErr, "marshaler", panicMarshaler{}, "map", nilMap, "nil", nil)
+		record := last()
+		if record["error"] != "<nil>" {
+			t.Errorf("%+v: typed nil error = %v, want <nil>", opts, record["error"])
+		}
+		if s, _ := record["marshaler"].(string); !strings.Contains(s, "!PANIC: boom") {
+			t.Errorf("%+v: panicking marshaler = %v", opts, record["marshaler"])
+		}
+		if record["map"] != nil || record["nil"] != nil {
+			t.Errorf("%+v: nil values = %v, %v", opts, record["map"], record["nil"])
+		}
+	}
+
+	// The same values through WithAttrs
+	l, last := newLimitLogger(t, LimitOptions{MaxValueSize: 8, MaxLen: 1})
+	l.With("error", pathErr, "marshaler", panicMarshaler{}).Info("with")
+	if record := last(); record["error"] != "<nil>" {
+		t.Errorf("WithAttrs: typed nil error = %v", record["error"])
+	}
+}
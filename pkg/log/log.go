@@ -3,6 +3,7 @@ package log
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -22,21 +23,41 @@ const (
 var (
 	Log *slog.Logger // global logger
 
-	logFolder string // log folder path
-	logFile   string // log file path
+	logFolder   string               // log folder path
+	logFile     string               // log file path
+	notifyFatal func(message string) // called by Fatal
+	sinks       []io.Closer          // sinks closed by Stop
 )
 
 type Options struct {
-	UserDir     string // User directory. Log file is stored in <UserDir>/log
-	Prefix      string // Prefix for log file name. <Prefix>.log.json
-	ShowDebug   bool   // Show debug logs
-	MaxLogFiles int    // Maximum number of log files
+	UserDir     string       // User directory. Log file is stored in <UserDir>/log. Defaults to the state directory of AppName
+	AppName     string       // Application name used to resolve UserDir. Defaults to the executable name
+	Prefix      string       // Prefix for log file name. <Prefix>.log.json
+	ShowDebug   bool         // Show debug logs
+	Level       slog.Leveler // Minimum level. Overrides ShowDebug if set
+	MaxLogFiles int          // Maximum number of log files
+
+	Source *SourceOptions // Rendering of the source location. Full paths if nil
+	Limits *LimitOptions  // Size limits for records. Unlimited if nil
+
+	Durability  DurabilityOptions    // When the log file is synced to disk
+	NotifyFatal func(message string) // Notifies the user before Fatal exits. It must block until the notification is shown, e.g. notify.NotifyOS
+
+	Middleware []func(slog.Handler) slog.Handler // Handler middlewares, e.g. Redact. The first one is the outermost
+	Ship       *ShipOptions                      // Ship logs to a HTTP endpoint. Disabled if nil
 }
 
 func Start(logOpts *Options) error {
 	// Check log options
 	if logOpts.UserDir == "" {
-		return fmt.Errorf("user directory cannot be empty")
+		if logOpts.AppName == "" {
+			logOpts.AppName = toolio.AppName()
+		}
+		dir, err := toolio.UserStateDir(logOpts.AppName)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user directory: %w", err)
+		}
+		logOpts.UserDir = dir
 	}
 	if logOpts.Prefix == "" {
 		logOpts.Prefix = defaultFileName
@@ -67,16 +88,46 @@ func Start(logOpts *Options) error {
 		return err
 	}
 	// Set log level
-	logLevel := slog.LevelInfo
+	var logLevel slog.Leveler = LevelInfo
 	if logOpts.ShowDebug {
-		logLevel = slog.LevelDebug
+		logLevel = LevelDebug
+	}
+	if logOpts.Level != nil {
+		logLevel = logOpts.Level
+	}
+	file := newSyncFile(f, logOpts.Durability)
+	sinks = []io.Closer{file}
+	writers := []io.Writer{os.Stderr, file}
+	// Start log shipping
+	if logOpts.Ship != nil {
+		s, err := newShipper(filepath.Join(logFolder, "spool"), *logOpts.Ship)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		sinks = append(sinks, s)
+		writers = append(writers, s)
 	}
 	// Create logger
-	writer := io.MultiWriter(os.Stderr, f)
-	jsonHandler := slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: logLevel, AddSource: true})
-	Log = slog.New(jsonHandler)
+	var handler slog.Handler = newJSONHandler(multiWriter(writers), logLevel, true, logOpts.Source)
+	if logOpts.Source != nil && logOpts.Source.MinLevel != nil {
+		handler = &sourceLevelHandler{handler, logOpts.Source.MinLevel}
+	}
+	if logOpts.Durability.Mode == SyncLevel {
+		level := logOpts.Durability.Level
+		if level == nil {
+			level = slog.LevelError
+		}
+		handler = &syncLevelHandler{handler, file, level}
+	}
+	if logOpts.Limits != nil {
+		handler = &limitHandler{Handler: handler, opts: logOpts.Limits}
+	}
+	handler = chain(handler, logOpts.Middleware)
+	Log = slog.New(handler)
+	notifyFatal = logOpts.NotifyFatal
 
-	Log.Debug("Successfully initialized the Logger.", "log file", logFile, "logger level", logLevel)
+	Log.Debug("Successfully initialized the Logger.", "log file", logFile, "logger level", LevelName(logLevel.Level()))
 	return nil
 }
 
@@ -87,11 +138,24 @@ func Must(logOpts *Options) {
 	}
 }
 
+// Flushes and closes all log sinks.
+//
+// Pending shipping batches are spooled to disk and sent on the next start.
+func Stop() error {
+	var errs []error
+	for i := len(sinks) - 1; i >= 0; i-- {
+		errs = append(errs, sinks[i].Close())
+	}
+	sinks = nil
+	return errors.Join(errs...)
+}
+
 // Handles log rotation.
 //
 //	On startup, a new log file is being created.
 //	If the log file already exists, it is renamed to `<name>.log.json.1`.
 //	If the new log file would exceed the maximum number of log files, the oldest log file is deleted.
+//	Attachments of a log file are renamed and deleted along with it.
 func rollLogFile(logFile string, logOpts *Options) error {
 	// Ignore if log file doesn't exist
 	if _, err := os.Stat(logFile); os.IsNotExist(err) {
@@ -116,7 +180,7 @@ func rollLogFile(logFile string, logOpts *Options) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		return os.RemoveAll(attachmentFolder(logFile))
 	}
 	// Get new log file name
 	var newLogFile string
@@ -135,6 +199,17 @@ func rollLogFile(logFile string, logOpts *Options) error {
 	if err != nil {
 		return err
 	}
+	// Rename attachment folder
+	if _, err := os.Stat(attachmentFolder(logFile)); err == nil {
+		err = os.RemoveAll(attachmentFolder(newLogFile))
+		if err != nil {
+			return err
+		}
+		err = os.Rename(attachmentFolder(logFile), attachmentFolder(newLogFile))
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -143,6 +218,7 @@ func rollLogFile(logFile string, logOpts *Options) error {
 //
 // Each line of the log file is a json object,
 // which is unmarshalled into a map.
+// Attachment references get a `path` to the stored payload.
 func GetLogs() ([]map[string]interface{}, error) {
 	// Open log file
 	file, err := os.Open(logFile)
@@ -154,6 +230,7 @@ func GetLogs() ([]map[string]interface{}, error) {
 	// Read log file
 	logs := make([]map[string]interface{}, 0)
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxScanTokenSize)
 	for scanner.Scan() {
 		l := make(map[string]interface{})
 		err := json.Unmarshal(scanner.Bytes(), &l)
@@ -161,10 +238,10 @@ func GetLogs() ([]map[string]interface{}, error) {
 			Log.Error("Failed to unmarshal log", "error", err)
 			return nil, err
 		}
-		l["_ERROR"] = l["level"] == "ERROR"
-		l["_WARN"] = l["level"] == "WARN"
-		l["_INFO"] = l["level"] == "INFO"
-		l["_DEBUG"] = l["level"] == "DEBUG"
+		for _, name := range levelNames {
+			l["_"+name] = l["level"] == name
+		}
+		resolveAttachments(l, attachmentFolder(logFile))
 		logs = append(logs, l)
 	}
 	// Check for errors
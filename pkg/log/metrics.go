@@ -0,0 +1,24 @@
+package log
+
+import "sync/atomic"
+
+var metrics struct {
+	truncatedAttrs   atomic.Uint64
+	truncatedRecords atomic.Uint64
+	rejectedBatches  atomic.Uint64
+}
+
+type Metrics struct {
+	TruncatedAttrs   uint64 // Attributes truncated or dropped due to LimitOptions
+	TruncatedRecords uint64 // Records exceeding LimitOptions.MaxRecordSize
+	RejectedBatches  uint64 // Shipped batches the endpoint rejected with a client error. They are dropped
+}
+
+// Returns the logger metrics since the start of the process.
+func GetMetrics() Metrics {
+	return Metrics{
+		TruncatedAttrs:   metrics.truncatedAttrs.Load(),
+		TruncatedRecords: metrics.truncatedRecords.Load(),
+		RejectedBatches:  metrics.rejectedBatches.Load(),
+	}
+}
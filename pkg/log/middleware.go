@@ -0,0 +1,156 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+// Wraps handler with the middlewares. The first middleware is the outermost one.
+func chain(handler slog.Handler, middlewares []func(slog.Handler) slog.Handler) slog.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Returns a middleware that rewrites every attribute, including the ones added with `Logger.With`.
+//
+//	groups holds the names of the enclosing groups, like in slog.HandlerOptions.ReplaceAttr.
+//	Group values are rewritten recursively. Returning an empty Attr drops the attribute.
+func ReplaceAttrs(fn func(groups []string, a slog.Attr) slog.Attr) func(slog.Handler) slog.Handler {
+	return func(next slog.Handler) slog.Handler {
+		return &replaceHandler{Handler: next, fn: fn}
+	}
+}
+
+type replaceHandler struct {
+	slog.Handler
+	fn     func(groups []string, a slog.Attr) slog.Attr
+	groups []string
+}
+
+func (h *replaceHandler) Handle(ctx context.Context, r slog.Record) error {
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		if a = h.replace(h.groups, a); !a.Equal(slog.Attr{}) {
+			nr.AddAttrs(a)
+		}
+		return true
+	})
+	return h.Handler.Handle(ctx, nr)
+}
+
+func (h *replaceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	replaced := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a = h.replace(h.groups, a); !a.Equal(slog.Attr{}) {
+			replaced = append(replaced, a)
+		}
+	}
+	return &replaceHandler{h.Handler.WithAttrs(replaced), h.fn, h.groups}
+}
+
+func (h *replaceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &replaceHandler{h.Handler.WithGroup(name), h.fn, append(slices.Clip(h.groups), name)}
+}
+
+func (h *replaceHandler) replace(groups []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return h.fn(groups, a)
+	}
+	inner := append(slices.Clip(groups), a.Key)
+	attrs := make([]slog.Attr, 0, len(a.Value.Group()))
+	for _, ga := range a.Value.Group() {
+		if ga = h.replace(inner, ga); !ga.Equal(slog.Attr{}) {
+			attrs = append(attrs, ga)
+		}
+	}
+	a.Value = slog.GroupValue(attrs...)
+	return a
+}
+
+// Returns a middleware that replaces the values of the given keys with `[REDACTED]`.
+// Keys are matched case-insensitively at any group level.
+func Redact(keys ...string) func(slog.Handler) slog.Handler {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return ReplaceAttrs(func(groups []string, a slog.Attr) slog.Attr {
+		if set[strings.ToLower(a.Key)] {
+			a.Value = slog.StringValue(redacted)
+		}
+		return a
+	})
+}
+
+// Returns a middleware that only keeps every n-th record below a level.
+// Records at or above the level are always kept.
+func Sample(below slog.Leveler, n int) func(slog.Handler) slog.Handler {
+	return func(next slog.Handler) slog.Handler {
+		return &sampleHandler{Handler: next, below: below, n: uint64(max(n, 1)), count: new(atomic.Uint64)}
+	}
+}
+
+type sampleHandler struct {
+	slog.Handler
+	below slog.Leveler
+	n     uint64
+	count *atomic.Uint64 // shared with derived handlers
+}
+
+func (h *sampleHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.below.Level() && (h.count.Add(1)-1)%h.n != 0 {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sampleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampleHandler{h.Handler.WithAttrs(attrs), h.below, h.n, h.count}
+}
+
+func (h *sampleHandler) WithGroup(name string) slog.Handler {
+	return &sampleHandler{h.Handler.WithGroup(name), h.below, h.n, h.count}
+}
+
+// Returns a middleware that adds attributes taken from the context to every record,
+// e.g. a request ID. The attributes are added inside the current group.
+func Enrich(fn func(ctx context.Context) []slog.Attr) func(slog.Handler) slog.Handler {
+	return func(next slog.Handler) slog.Handler {
+		return &enrichHandler{Handler: next, fn: fn}
+	}
+}
+
+type enrichHandler struct {
+	slog.Handler
+	fn func(ctx context.Context) []slog.Attr
+}
+
+func (h *enrichHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if attrs := h.fn(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *enrichHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &enrichHandler{h.Handler.WithAttrs(attrs), h.fn}
+}
+
+func (h *enrichHandler) WithGroup(name string) slog.Handler {
+	return &enrichHandler{h.Handler.WithGroup(name), h.fn}
+}
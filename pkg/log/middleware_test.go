@@ -0,0 +1,130 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Returns a logger with the middlewares, and a function decoding the records written since the last call.
+func newMiddlewareLogger(t *testing.T, middlewares ...func(slog.Handler) slog.Handler) (*slog.Logger, func() []map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := slog.New(chain(newJSONHandler(&buf, LevelTrace, false, nil), middlewares))
+	records := func() []map[string]any {
+		t.Helper()
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			err := json.Unmarshal([]byte(line), &record)
+			if err != nil {
+				t.Fatalf("invalid record %s: %v", line, err)
+			}
+			delete(record, "time")
+			delete(record, "level")
+			records = append(records, record)
+		}
+		buf.Reset()
+		return records
+	}
+	return l, records
+}
+
+func TestRedact(t *testing.T) {
+	l, records := newMiddlewareLogger(t, Redact("password", "Token"))
+	tests := []struct {
+		name string
+		log  func()
+		want string // JSON
+	}{
+		{"record", func() { l.Info("m", "TOKEN", "t", "user", "u") },
+			`{"TOKEN":"[REDACTED]","msg":"m","user":"u"}`},
+		{"With", func() { l.With("password", "p", "user", "u").Info("m") },
+			`{"msg":"m","password":"[REDACTED]","user":"u"}`},
+		{"WithGroup", func() { l.WithGroup("req").Info("m", "token", "t", "id", 1) },
+			`{"msg":"m","req":{"id":1,"token":"[REDACTED]"}}`},
+		{"WithGroup and With", func() { l.WithGroup("req").With("password", "p").Info("m") },
+			`{"msg":"m","req":{"password":"[REDACTED]"}}`},
+		{"group value", func() { l.Info("m", slog.Group("auth", "user", "u", slog.Group("basic", "password", "p"))) },
+			`{"auth":{"basic":{"password":"[REDACTED]"},"user":"u"},"msg":"m"}`},
+	}
+	for _, tt := range tests {
+		tt.log()
+		got := records()
+		if len(got) != 1 {
+			t.Fatalf("%s: %d records", tt.name, len(got))
+		}
+		b, _ := json.Marshal(got[0])
+		if string(b) != tt.want {
+			t.Errorf("%s: record = %s, want %s", tt.name, b, tt.want)
+		}
+	}
+}
+
+func TestReplaceAttrs(t *testing.T) {
+	var seen []string
+	l, records := newMiddlewareLogger(t, ReplaceAttrs(func(groups []string, a slog.Attr) slog.Attr {
+		seen = append(seen, strings.Join(append(groups, a.Key), "."))
+		if a.Key == "drop" {
+			return slog.Attr{}
+		}
+		return a
+	}))
+	l.WithGroup("g").With("w", 1).Info("m", "drop", 1, slog.Group("h", "drop", 2, "keep", 3), "v", valuer{})
+	if got, want := strings.Join(seen, " "), "g.w g.drop g.h.drop g.h.keep g.v.a"; got != want {
+		t.Errorf("replaced %s, want %s", got, want)
+	}
+	b, _ := json.Marshal(records()[0])
+	if want := `{"g":{"h":{"keep":3},"v":{"a":"b"},"w":1},"msg":"m"}`; string(b) != want {
+		t.Errorf("record = %s, want %s", b, want)
+	}
+}
+
+func TestSample(t *testing.T) {
+	l, records := newMiddlewareLogger(t, Sample(slog.LevelWarn, 3))
+	// Derived loggers share the count
+	loggers := []*slog.Logger{l, l.With("a", 1), l.WithGroup("g"), l.With("b", 2).WithGroup("h")}
+	for i := range 12 {
+		loggers[i%len(loggers)].Info("info")
+	}
+	if got := len(records()); got != 4 {
+		t.Errorf("kept %d of 12 records, want 4", got)
+	}
+	for i := range 5 {
+		loggers[i%len(loggers)].Warn("warn")
+	}
+	if got := len(records()); got != 5 {
+		t.Errorf("kept %d of 5 warnings, want all", got)
+	}
+}
+
+type requestIDKey struct{}
+
+func TestEnrich(t *testing.T) {
+	l, records := newMiddlewareLogger(t, Enrich(func(ctx context.Context) []slog.Attr {
+		if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+			return []slog.Attr{slog.String("request_id", id)}
+		}
+		return nil
+	}))
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "r1")
+	l.InfoContext(ctx, "m")
+	l.WithGroup("g").InfoContext(ctx, "m", "a", 1)
+	l.Info("m")
+	got := records()
+	want := []string{`{"msg":"m","request_id":"r1"}`, `{"g":{"a":1,"request_id":"r1"},"msg":"m"}`, `{"msg":"m"}`}
+	if len(got) != len(want) {
+		t.Fatalf("%d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if b, _ := json.Marshal(got[i]); string(b) != want[i] {
+			t.Errorf("record %d = %s, want %s", i, b, want[i])
+		}
+	}
+}
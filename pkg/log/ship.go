@@ -0,0 +1,331 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	toolio "github.com/johannes-luebke/gotool/pkg/io"
+)
+
+const (
+	defaultShipBatchSize     = 500
+	defaultShipFlushInterval = 5 * time.Second
+	defaultShipMaxSpoolSize  = 64 << 20 // 64 MiB
+	defaultShipMinBackoff    = time.Second
+	defaultShipMaxBackoff    = 5 * time.Minute
+	shipShutdownTimeout      = 5 * time.Second
+	spoolFileExt             = ".ndjson"
+)
+
+type ShipOptions struct {
+	Endpoint      string        // URL the NDJSON batches are POSTed to
+	Header        http.Header   // Additional request headers, e.g. for authentication
+	Gzip          bool          // Gzip the request body
+	BatchSize     int           // Maximum number of records per batch
+	FlushInterval time.Duration // Maximum time a record waits before its batch is spooled
+	MaxSpoolSize  int64         // Maximum size of the spool folder in bytes. Oldest batches are dropped first
+	MinBackoff    time.Duration // First retry delay after a failed upload
+	MaxBackoff    time.Duration // Upper bound for the retry delay
+	Client        *http.Client  // HTTP client. Defaults to a client with a 30s timeout
+}
+
+// Ships log records to a HTTP endpoint.
+//
+//	Records are collected into batches, which are written to <UserDir>/log/spool first.
+//	A background goroutine uploads the spooled batches oldest first and removes them on success.
+//	Failed uploads are retried with exponential backoff, batches left over from a previous run are sent on startup.
+type shipper struct {
+	opts ShipOptions
+	dir  string
+
+	mu    sync.Mutex
+	batch bytes.Buffer
+	count int
+	seq   int
+	timer *time.Timer
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newShipper(dir string, opts ShipOptions) (*shipper, error) {
+	// Check ship options
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("ship endpoint cannot be empty")
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = defaultShipBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultShipFlushInterval
+	}
+	if opts.MaxSpoolSize <= 0 {
+		opts.MaxSpoolSize = defaultShipMaxSpoolSize
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultShipMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultShipMaxBackoff, opts.MinBackoff)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	// Create spool folder if it doesn't exist
+	err := os.MkdirAll(dir, toolio.Perm755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shipper{
+		opts:    opts,
+		dir:     dir,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Adds a single record to the current batch.
+func (s *shipper) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batch.Write(p)
+	if len(p) > 0 && p[len(p)-1] != '\n' {
+		s.batch.WriteByte('\n')
+	}
+	s.count++
+	if s.count >= s.opts.BatchSize {
+		return len(p), s.spoolLocked()
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.opts.FlushInterval, s.flush)
+	}
+	return len(p), nil
+}
+
+// Spools the current batch.
+func (s *shipper) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spoolLocked()
+}
+
+// Writes the current batch to the spool folder and wakes up the sender.
+// The caller must hold s.mu.
+func (s *shipper) spoolLocked() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.count == 0 {
+		return nil
+	}
+	defer func() {
+		s.batch.Reset()
+		s.count = 0
+	}()
+	// Write to a temporary file first, so the sender never sees partial batches
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq, spoolFileExt)
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	err := os.WriteFile(tmp, s.batch.Bytes(), toolio.Perm666)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(s.dir, name))
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Enforce spool size limit
+	err = s.trimSpool()
+	if err != nil {
+		return err
+	}
+	// Wake up sender
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Returns the spooled batches, oldest first.
+func (s *shipper) spoolFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolFileExt) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files = append(files, e.Name())
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Deletes the oldest batches until the spool folder fits into MaxSpoolSize.
+func (s *shipper) trimSpool() error {
+	files, err := s.spoolFiles()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, name := range files {
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil {
+			continue
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+	for i := 0; total > s.opts.MaxSpoolSize && i < len(files); i++ {
+		err := os.Remove(filepath.Join(s.dir, files[i]))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= sizes[i]
+	}
+	return nil
+}
+
+// Uploads spooled batches until stopped.
+func (s *shipper) run() {
+	defer close(s.stopped)
+
+	backoff := s.opts.MinBackoff
+	for {
+		err := s.send(context.Background())
+		if err == nil {
+			backoff = s.opts.MinBackoff
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				s.sendOnShutdown()
+				return
+			}
+		}
+		// Retry with exponential backoff
+		retry := time.NewTimer(backoff)
+		backoff = min(backoff*2, s.opts.MaxBackoff)
+		select {
+		case <-retry.C:
+		case <-s.done:
+			retry.Stop()
+			return
+		}
+	}
+}
+
+// Gives the sender a last chance to upload the remaining batches.
+// Whatever is left is sent on the next start.
+func (s *shipper) sendOnShutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shipShutdownTimeout)
+	defer cancel()
+	s.send(ctx)
+}
+
+// Uploads all spooled batches, oldest first.
+func (s *shipper) send(ctx context.Context) error {
+	files, err := s.spoolFiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue // dropped by trimSpool in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		err = s.post(ctx, data)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// POSTs a single batch to the endpoint.
+//
+//	Server errors, timeouts and 429 are retried.
+//	Other client errors will never succeed, so the batch is dropped and counted in Metrics.RejectedBatches.
+func (s *shipper) post(ctx context.Context, data []byte) error {
+	body := data
+	if s.opts.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		err := zw.Close()
+		if err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	res, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return fmt.Errorf("log shipping failed: %s", res.Status)
+	default:
+		// Logging this would go through the shipper again
+		metrics.rejectedBatches.Add(1)
+		fmt.Fprintf(os.Stderr, "log shipping rejected a batch, dropping it: %s\n", res.Status)
+		return nil
+	}
+}
+
+// Spools the pending batch and stops the sender.
+func (s *shipper) Close() error {
+	s.mu.Lock()
+	err := s.spoolLocked()
+	s.mu.Unlock()
+
+	close(s.done)
+	<-s.stopped
+	return err
+}
@@ -0,0 +1,256 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type shipRequest struct {
+	header http.Header
+	body   string // decompressed
+}
+
+// Starts an endpoint, which answers the n-th request with status(n) and reports every request.
+func shipEndpoint(t *testing.T, status func(n int) int) (string, <-chan shipRequest) {
+	t.Helper()
+	requests := make(chan shipRequest, 100)
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("invalid gzip body: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+		requests <- shipRequest{r.Header, string(data)}
+		w.WriteHeader(status(int(n.Add(1)) - 1))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, requests
+}
+
+func statusOK(int) int { return http.StatusOK }
+
+func nextRequest(t *testing.T, requests <-chan shipRequest) shipRequest {
+	t.Helper()
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a request")
+		return shipRequest{}
+	}
+}
+
+func record(i int) []byte {
+	return []byte(fmt.Sprintf(`{"msg":"record %d"}`, i))
+}
+
+func spoolContents(t *testing.T, s *shipper) []string {
+	t.Helper()
+	files, err := s.spoolFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make([]string, len(files))
+	for i, name := range files {
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[i] = string(data)
+	}
+	return contents
+}
+
+func TestShipBatches(t *testing.T) {
+	url, requests := shipEndpoint(t, statusOK)
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, BatchSize: 3, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		s.Write(record(i))
+	}
+	r := nextRequest(t, requests)
+	if ct := r.header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if r.header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding = %q without Gzip", r.header.Get("Content-Encoding"))
+	}
+	want := `{"msg":"record 0"}` + "\n" + `{"msg":"record 1"}` + "\n" + `{"msg":"record 2"}` + "\n"
+	if r.body != want {
+		t.Errorf("first batch = %q, want %q", r.body, want)
+	}
+
+	// Close spools and sends the incomplete batch
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = nextRequest(t, requests)
+	want = `{"msg":"record 3"}` + "\n" + `{"msg":"record 4"}` + "\n"
+	if r.body != want {
+		t.Errorf("second batch = %q, want %q", r.body, want)
+	}
+	if left := spoolContents(t, s); len(left) != 0 {
+		t.Errorf("spool not empty after upload: %q", left)
+	}
+}
+
+func TestShipFlushInterval(t *testing.T) {
+	url, requests := shipEndpoint(t, statusOK)
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Write(append(record(0), '\n'))
+	if r := nextRequest(t, requests); r.body != string(record(0))+"\n" {
+		t.Errorf("batch = %q", r.body)
+	}
+}
+
+func TestShipGzip(t *testing.T) {
+	url, requests := shipEndpoint(t, statusOK)
+	header := http.Header{"Authorization": {"Bearer token"}}
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, Header: header, Gzip: true, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Write(record(0))
+	s.Write(record(1))
+	r := nextRequest(t, requests)
+	if ce := r.header.Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", ce)
+	}
+	if auth := r.header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if want := string(record(0)) + "\n" + string(record(1)) + "\n"; r.body != want {
+		t.Errorf("body = %q, want %q", r.body, want)
+	}
+}
+
+func TestShipRetry(t *testing.T) {
+	url, requests := shipEndpoint(t, func(n int) int {
+		if n < 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, BatchSize: 1, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	start := time.Now()
+	s.Write(record(0))
+	for range 3 {
+		if r := nextRequest(t, requests); r.body != string(record(0))+"\n" {
+			t.Errorf("body = %q", r.body)
+		}
+	}
+	// Backoff of 10ms and 20ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("retried after %v, want backoff of at least 30ms", elapsed)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(spoolContents(t, s)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if left := spoolContents(t, s); len(left) != 0 {
+		t.Errorf("spool not empty after successful retry: %q", left)
+	}
+}
+
+func TestShipRejected(t *testing.T) {
+	url, requests := shipEndpoint(t, func(int) int { return http.StatusBadRequest })
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, BatchSize: 1, MinBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := GetMetrics().RejectedBatches
+	discardStderr(t)
+	s.Write(record(0))
+	nextRequest(t, requests)
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := GetMetrics().RejectedBatches - rejected; got != 1 {
+		t.Errorf("RejectedBatches increased by %d, want 1", got)
+	}
+	if left := spoolContents(t, s); len(left) != 0 {
+		t.Errorf("rejected batch kept in spool: %q", left)
+	}
+}
+
+func TestShipSpoolLimit(t *testing.T) {
+	url, requests := shipEndpoint(t, func(int) int { return http.StatusServiceUnavailable })
+	// Each batch has 19 bytes, so 3 batches fit
+	s, err := newShipper(t.TempDir(), ShipOptions{Endpoint: url, BatchSize: 1, MaxSpoolSize: 60, MinBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Write(record(0))
+	nextRequest(t, requests) // the sender waits for an hour now
+	for i := 1; i < 10; i++ {
+		s.Write(record(i))
+	}
+	got := spoolContents(t, s)
+	want := []string{string(record(7)) + "\n", string(record(8)) + "\n", string(record(9)) + "\n"}
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("spool = %q, want the newest batches %q", got, want)
+	}
+}
+
+func TestShipResume(t *testing.T) {
+	discardStderr(t)
+	dir := t.TempDir()
+	failing, failed := shipEndpoint(t, func(int) int { return http.StatusServiceUnavailable })
+	err := Start(&Options{UserDir: dir, Ship: &ShipOptions{Endpoint: failing, BatchSize: 1, MinBackoff: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Log.Info("First.")
+	nextRequest(t, failed)
+	Log.Info("Second.")
+	err = Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next start sends the batches left over, oldest first
+	url, requests := shipEndpoint(t, statusOK)
+	err = Start(&Options{UserDir: dir, Ship: &ShipOptions{Endpoint: url, BatchSize: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Stop()
+	for _, msg := range []string{`"msg":"First."`, `"msg":"Second."`} {
+		if r := nextRequest(t, requests); !strings.Contains(r.body, msg) {
+			t.Errorf("body = %q, want %s", r.body, msg)
+		}
+	}
+}
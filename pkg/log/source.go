@@ -0,0 +1,122 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+type SourceFormat int
+
+const (
+	SourceFull   SourceFormat = iota // Absolute file path, as reported by the runtime
+	SourceModule                     // Path relative to the main module. Other modules keep their import path
+	SourceBase                       // File name only
+)
+
+type SourceOptions struct {
+	Format        SourceFormat // How the file path is rendered
+	ShortFunction bool         // Strip the package path from function names. `pkg.(*T).Method` instead of `github.com/org/mod/pkg.(*T).Method`
+	MinLevel      slog.Leveler // Omit the source for records below this level. Keep it for all records if nil
+	KeepFullPath  bool         // Additionally store the absolute path in `source.path`
+}
+
+// Returns the path of the main module, e.g. `github.com/johannes-luebke/gotool`.
+var mainModule = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Path
+})
+
+// Rewrites the source attribute added by `AddSource`.
+func (o *SourceOptions) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 || a.Key != slog.SourceKey {
+		return a
+	}
+	src, ok := a.Value.Any().(*slog.Source)
+	if !ok {
+		return a
+	}
+	// Records without a PC, e.g. from sourceLevelHandler, get an empty source
+	if src.File == "" && src.Line == 0 {
+		return slog.Attr{}
+	}
+	attrs := []slog.Attr{
+		slog.String("function", o.function(src.Function)),
+		slog.String("file", o.file(src)),
+		slog.Int("line", src.Line),
+	}
+	if o.KeepFullPath {
+		attrs = append(attrs, slog.String("path", src.File))
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(attrs...)}
+}
+
+func (o *SourceOptions) function(fn string) string {
+	if !o.ShortFunction {
+		return fn
+	}
+	return fn[strings.LastIndexByte(fn, '/')+1:]
+}
+
+func (o *SourceOptions) file(src *slog.Source) string {
+	switch o.Format {
+	case SourceBase:
+		return filepath.Base(src.File)
+	case SourceModule:
+		// The package path is taken from the function name, so no assumptions about
+		// GOPATH, the module cache or the build machine have to be made.
+		pkg := packagePath(src.Function)
+		if pkg == "" || pkg == "main" {
+			return filepath.Base(src.File)
+		}
+		file := path.Join(pkg, filepath.Base(src.File))
+		if mod := mainModule(); mod != "" && mod != "command-line-arguments" {
+			if file == mod || strings.HasPrefix(file, mod+"/") {
+				file = strings.TrimPrefix(file[len(mod):], "/")
+			}
+		}
+		return file
+	default:
+		return src.File
+	}
+}
+
+// Returns the package import path of a fully qualified function name.
+//
+//	`github.com/org/mod/pkg.(*T).Method` -> `github.com/org/mod/pkg`
+func packagePath(fn string) string {
+	slash := strings.LastIndexByte(fn, '/')
+	dot := strings.IndexByte(fn[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return fn[:slash+1+dot]
+}
+
+// Drops the source of records below a minimum level.
+type sourceLevelHandler struct {
+	slog.Handler
+	minLevel slog.Leveler
+}
+
+func (h *sourceLevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.minLevel.Level() {
+		r.PC = 0
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sourceLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sourceLevelHandler{h.Handler.WithAttrs(attrs), h.minLevel}
+}
+
+func (h *sourceLevelHandler) WithGroup(name string) slog.Handler {
+	return &sourceLevelHandler{h.Handler.WithGroup(name), h.minLevel}
+}
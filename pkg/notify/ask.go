@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type ResponseKind int
+
+const (
+	ResponseAction    ResponseKind = iota // The user clicked an action
+	ResponseDismissed                     // The user closed the notification
+	ResponseTimeout                       // The notification expired or the context deadline passed
+)
+
+func (k ResponseKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ResponseKind) UnmarshalText(text []byte) error {
+	for _, kind := range []ResponseKind{ResponseAction, ResponseDismissed, ResponseTimeout} {
+		if string(text) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown response kind %q", text)
+}
+
+func (k ResponseKind) String() string {
+	switch k {
+	case ResponseAction:
+		return "action"
+	case ResponseDismissed:
+		return "dismissed"
+	default:
+		return "timeout"
+	}
+}
+
+// The user's reaction to a notification.
+type Response struct {
+	Kind   ResponseKind `json:"kind"`
+	Action string       `json:"action,omitempty"` // ID of the clicked action, if Kind is ResponseAction
+}
+
+// Notifier, which can wait for the user's response.
+type Asker interface {
+	Ask(ctx context.Context, n Notification) (Response, error)
+}
+
+// Adapts a function to the Asker interface, e.g. for stubs in tests.
+type AskerFunc func(ctx context.Context, n Notification) (Response, error)
+
+func (f AskerFunc) Ask(ctx context.Context, n Notification) (Response, error) {
+	return f(ctx, n)
+}
+
+func (f AskerFunc) Notify(ctx context.Context, n Notification) error {
+	_, err := f(ctx, n)
+	return err
+}
+
+// Returned by backends, which can't wait for a response.
+var errAskUnsupported = errors.New("backend can't wait for a response")
+
+// Shows a notification and waits for the user's response.
+//
+// If the default notifier can't wait for a response, the user is prompted on the terminal.
+// A passed context deadline is reported as ResponseTimeout.
+// The policy of SetPolicy applies: while it holds back notifications, Ask returns ErrHeld without asking.
+func Ask(ctx context.Context, n Notification) (Response, error) {
+	r, err := ask(ctx, n)
+	if err != nil {
+		recordHistory(n, err, nil)
+	} else {
+		recordHistory(n, nil, &r)
+	}
+	return r, err
+}
+
+func ask(ctx context.Context, n Notification) (Response, error) {
+	r, err := defaultPolicy().Ask(ctx, n)
+	if !errors.Is(err, errAskUnsupported) {
+		return timeoutResponse(ctx, r, err)
+	}
+	if !isTerminal(os.Stdin) {
+		return Response{}, &Error{Backend: "prompt", Kind: ErrUnavailable, Err: fmt.Errorf("no backend can wait for a response")}
+	}
+	r, err = Prompt{In: os.Stdin, Out: os.Stderr}.Ask(ctx, n)
+	return timeoutResponse(ctx, r, err)
+}
+
+// Turns a passed deadline into ResponseTimeout.
+func timeoutResponse(ctx context.Context, r Response, err error) (Response, error) {
+	if (errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded)) && ctx.Err() != nil {
+		return Response{Kind: ResponseTimeout}, nil
+	}
+	return r, err
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Asks the user on a terminal.
+//
+//	Actions are listed with numbers and can be chosen by number, ID or label.
+//	An empty line dismisses the notification.
+//
+// Lines of In are read by one background goroutine, which is shared by all prompts on In
+// and ends at EOF or a read error.
+type Prompt struct {
+	In  io.Reader
+	Out io.Writer
+}
+
+func (p Prompt) Notify(ctx context.Context, n Notification) error {
+	n = withDefaults(n)
+	_, err := fmt.Fprintln(p.Out, promptText(n))
+	return err
+}
+
+func (p Prompt) Ask(ctx context.Context, n Notification) (Response, error) {
+	n = withDefaults(n)
+	text := promptText(n)
+	if len(n.Actions) == 0 {
+		text += "\n[Enter] to dismiss: "
+	} else {
+		for i, a := range n.Actions {
+			text += fmt.Sprintf("\n  %d) %s", i+1, a.Label)
+		}
+		text += "\nChoice: "
+	}
+	_, err := io.WriteString(p.Out, text)
+	if err != nil {
+		return Response{}, err
+	}
+
+	lines := readLines(p.In)
+	for {
+		select {
+		case line := <-lines.lines:
+			line = strings.TrimSpace(line)
+			if line == "" {
+				return Response{Kind: ResponseDismissed}, nil
+			}
+			if a, ok := matchAction(n.Actions, line); ok {
+				return Response{Kind: ResponseAction, Action: a.ID}, nil
+			}
+			fmt.Fprint(p.Out, "Invalid choice: ")
+		case <-lines.done:
+			if errors.Is(lines.err, io.EOF) {
+				return Response{Kind: ResponseDismissed}, nil
+			}
+			return Response{}, lines.err
+		case <-ctx.Done():
+			fmt.Fprintln(p.Out)
+			return Response{}, ctx.Err()
+		}
+	}
+}
+
+// Reads lines in the background, since reading can't be interrupted.
+// Each line is handed to exactly one receiver, so a line typed after an
+// abandoned prompt goes to the next one.
+type lineReader struct {
+	lines chan string
+	done  chan struct{} // Closed after the last line, err is set then
+	err   error
+}
+
+// Line readers by input, removed at EOF or a read error.
+var lineReaders sync.Map
+
+// Returns the line reader of in, starting it on first use.
+func readLines(in io.Reader) *lineReader {
+	r := &lineReader{lines: make(chan string), done: make(chan struct{})}
+	if t := reflect.TypeOf(in); t != nil && !t.Comparable() {
+		// Can't be shared, but such readers are rare
+		go r.read(in, false)
+		return r
+	}
+	if shared, loaded := lineReaders.LoadOrStore(in, r); loaded {
+		return shared.(*lineReader)
+	}
+	go r.read(in, true)
+	return r
+}
+
+func (r *lineReader) read(in io.Reader, shared bool) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		r.lines <- scanner.Text()
+	}
+	r.err = scanner.Err()
+	if r.err == nil {
+		r.err = io.EOF
+	}
+	if shared {
+		lineReaders.Delete(in)
+	}
+	close(r.done)
+}
+
+// Returns the action chosen by number, ID or label.
+func matchAction(actions []Action, choice string) (Action, bool) {
+	if i, err := strconv.Atoi(choice); err == nil && i >= 1 && i <= len(actions) {
+		return actions[i-1], true
+	}
+	for _, a := range actions {
+		if strings.EqualFold(a.ID, choice) || strings.EqualFold(a.Label, choice) {
+			return a, true
+		}
+	}
+	return Action{}, false
+}
+
+func promptText(n Notification) string {
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(n.Severity.String()), n.Title)
+	return joinLines(title, plainBody(n))
+}
@@ -0,0 +1,307 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Replaces the default notifier for the test.
+func setDefault(t *testing.T, n Notifier) {
+	t.Helper()
+	defaultMu.Lock()
+	prev := defaultNotifier
+	defaultMu.Unlock()
+	SetDefault(n)
+	t.Cleanup(func() { SetDefault(prev) })
+}
+
+var testActions = []Action{{ID: "yes", Label: "Yes, please"}, {ID: "no", Label: "No"}}
+
+// Waits until ctx is done and fails like a backend.
+func waitForDeadline(ctx context.Context, n Notification) (Response, error) {
+	<-ctx.Done()
+	return Response{}, deliveryError(ctx, "stub", ErrTransport, ctx.Err())
+}
+
+func TestAsk(t *testing.T) {
+	tests := []struct {
+		name    string
+		asker   AskerFunc
+		timeout time.Duration
+		want    Response
+		wantErr error
+	}{
+		{"action", func(ctx context.Context, n Notification) (Response, error) {
+			return Response{Kind: ResponseAction, Action: n.Actions[1].ID}, nil
+		}, 0, Response{Kind: ResponseAction, Action: "no"}, nil},
+		{"dismissed", func(ctx context.Context, n Notification) (Response, error) {
+			return Response{Kind: ResponseDismissed}, nil
+		}, 0, Response{Kind: ResponseDismissed}, nil},
+		{"expired", func(ctx context.Context, n Notification) (Response, error) {
+			return Response{Kind: ResponseTimeout}, nil
+		}, 0, Response{Kind: ResponseTimeout}, nil},
+		{"deadline", waitForDeadline, 10 * time.Millisecond, Response{Kind: ResponseTimeout}, nil},
+		{"failed", func(ctx context.Context, n Notification) (Response, error) {
+			return Response{}, &Error{Backend: "stub", Kind: ErrRejected, Err: errors.New("exit status 1")}
+		}, 0, Response{}, ErrRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDefault(t, tt.asker)
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			r, err := Ask(ctx, Notification{Title: "t", Actions: testActions})
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if r != tt.want {
+				t.Errorf("response = %+v, want %+v", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestAskUnsupported(t *testing.T) {
+	if isTerminal(os.Stdin) {
+		t.Skip("stdin is a terminal, so Ask prompts")
+	}
+	setDefault(t, NotifierFunc(func(ctx context.Context, n Notification) error {
+		t.Error("Ask used Notify")
+		return nil
+	}))
+	_, err := Ask(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestTimeoutResponse(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	timeoutErr := &Error{Backend: "stub", Kind: ErrTimeout, Err: context.DeadlineExceeded}
+	action := Response{Kind: ResponseAction, Action: "a"}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		r       Response
+		err     error
+		want    Response
+		wantErr error
+	}{
+		{"response", context.Background(), action, nil, action, nil},
+		{"response after deadline", expired, action, nil, action, nil},
+		{"deadline", expired, Response{}, context.DeadlineExceeded, Response{Kind: ResponseTimeout}, nil},
+		{"backend timeout after deadline", expired, Response{}, timeoutErr, Response{Kind: ResponseTimeout}, nil},
+		// The backend's own timeout is a failure, while the context is still alive
+		{"backend timeout", context.Background(), Response{}, timeoutErr, Response{}, ErrTimeout},
+		{"canceled", canceled, Response{}, context.Canceled, Response{}, context.Canceled},
+		{"failure after deadline", expired, Response{}, ErrRejected, Response{}, ErrRejected},
+	}
+	for _, tt := range tests {
+		r, err := timeoutResponse(tt.ctx, tt.r, tt.err)
+		if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if r != tt.want {
+			t.Errorf("%s: response = %+v, want %+v", tt.name, r, tt.want)
+		}
+	}
+}
+
+func TestFallbackAsk(t *testing.T) {
+	var calls []string
+	notifier := func(name string) NotifierFunc {
+		return func(ctx context.Context, n Notification) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	asker := func(name string, r Response, err error) AskerFunc {
+		return func(ctx context.Context, n Notification) (Response, error) {
+			calls = append(calls, name)
+			return r, err
+		}
+	}
+	action := Response{Kind: ResponseAction, Action: "a"}
+	failed := &Error{Backend: "failed", Kind: ErrTransport, Err: errors.New("broken pipe")}
+
+	tests := []struct {
+		name      string
+		fallback  Fallback
+		want      Response
+		wantErr   error
+		wantCalls string
+	}{
+		{"skips notifiers", Fallback{notifier("notify"), asker("ask", action, nil)}, action, nil, "ask"},
+		{"skips unsupported", Fallback{asker("unsupported", Response{}, errAskUnsupported), asker("ask", action, nil)}, action, nil, "unsupported ask"},
+		{"falls back on failure", Fallback{asker("failed", Response{}, failed), asker("ask", action, nil)}, action, nil, "failed ask"},
+		{"no asker", Fallback{notifier("a"), notifier("b")}, Response{}, errAskUnsupported, ""},
+		{"all failed", Fallback{asker("failed", Response{}, failed), notifier("notify")}, Response{}, ErrTransport, "failed"},
+	}
+	for _, tt := range tests {
+		calls = nil
+		r, err := tt.fallback.Ask(context.Background(), Notification{Title: "t"})
+		if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if r != tt.want {
+			t.Errorf("%s: response = %+v, want %+v", tt.name, r, tt.want)
+		}
+		if got := strings.Join(calls, " "); got != tt.wantCalls {
+			t.Errorf("%s: calls = %q, want %q", tt.name, got, tt.wantCalls)
+		}
+	}
+
+	// A failure after the deadline doesn't fall back, and isn't reported as unsupported
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = nil
+	_, err := Fallback{asker("failed", Response{}, failed), asker("ask", action, nil)}.Ask(ctx, Notification{Title: "t"})
+	if !errors.Is(err, ErrTransport) || errors.Is(err, errAskUnsupported) || len(calls) != 1 {
+		t.Errorf("canceled: error = %v, calls = %q", err, calls)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		actions []Action
+		want    Response
+	}{
+		{"number", "2\n", testActions, Response{Kind: ResponseAction, Action: "no"}},
+		{"ID", "YES\n", testActions, Response{Kind: ResponseAction, Action: "yes"}},
+		{"label", "  yes, please \n", testActions, Response{Kind: ResponseAction, Action: "yes"}},
+		{"invalid choice", "3\nmaybe\n1\n", testActions, Response{Kind: ResponseAction, Action: "yes"}},
+		{"empty line", "\n1\n", testActions, Response{Kind: ResponseDismissed}},
+		{"EOF", "", testActions, Response{Kind: ResponseDismissed}},
+		{"EOF after invalid choice", "maybe", testActions, Response{Kind: ResponseDismissed}},
+		{"no actions", "\n", nil, Response{Kind: ResponseDismissed}},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		p := Prompt{In: strings.NewReader(tt.input), Out: &out}
+		r, err := p.Ask(context.Background(), Notification{Title: "Deploy?", Message: "To production", Actions: tt.actions})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if r != tt.want {
+			t.Errorf("%s: response = %+v, want %+v", tt.name, r, tt.want)
+		}
+		if !strings.HasPrefix(out.String(), "[INFO] Deploy?\nTo production\n") {
+			t.Errorf("%s: output = %q", tt.name, out.String())
+		}
+	}
+
+	var out strings.Builder
+	Prompt{In: strings.NewReader("1\n"), Out: &out}.Ask(context.Background(), Notification{Title: "t", Actions: testActions})
+	if want := "\n  1) Yes, please\n  2) No\nChoice: "; !strings.HasSuffix(out.String(), want) {
+		t.Errorf("output = %q, want suffix %q", out.String(), want)
+	}
+
+	// Reading blocks, so the context ends the prompt
+	in, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := Prompt{In: in, Out: io.Discard}.Ask(ctx, Notification{Title: "t"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The abandoned prompt doesn't swallow the next line
+	go io.WriteString(w, "2\n")
+	r, err := Prompt{In: in, Out: io.Discard}.Ask(context.Background(), Notification{Title: "t", Actions: testActions})
+	if err != nil || r != (Response{Kind: ResponseAction, Action: "no"}) {
+		t.Errorf("second prompt = %+v, %v", r, err)
+	}
+	go io.WriteString(w, "1\n")
+	r, err = Prompt{In: in, Out: io.Discard}.Ask(context.Background(), Notification{Title: "t", Actions: testActions})
+	if err != nil || r != (Response{Kind: ResponseAction, Action: "yes"}) {
+		t.Errorf("third prompt = %+v, %v", r, err)
+	}
+	w.Close()
+	if r, err := (Prompt{In: in, Out: io.Discard}).Ask(context.Background(), Notification{Title: "t"}); err != nil || r.Kind != ResponseDismissed {
+		t.Errorf("prompt at EOF = %+v, %v", r, err)
+	}
+
+	_, err = Prompt{In: errReader{}, Out: io.Discard}.Ask(context.Background(), Notification{Title: "t"})
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("error = %v, want the read error", err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestOSAScriptResponse(t *testing.T) {
+	n := Notification{Title: "t", Actions: []Action{{ID: "retry", Label: "Retry"}, {ID: "comma", Label: "A, gave up:false"}}}
+	tests := []struct {
+		output  string
+		err     error
+		want    Response
+		wantErr error
+	}{
+		{"button returned:Retry\n", nil, Response{Kind: ResponseAction, Action: "retry"}, nil},
+		{"button returned:Retry, gave up:false\n", nil, Response{Kind: ResponseAction, Action: "retry"}, nil},
+		{"button returned:A, gave up:false, gave up:false", nil, Response{Kind: ResponseAction, Action: "comma"}, nil},
+		{"button returned:OK", nil, Response{Kind: ResponseDismissed}, nil},
+		{"button returned:, gave up:true\n", nil, Response{Kind: ResponseTimeout}, nil},
+		{"", &Error{Backend: "osascript", Kind: ErrRejected, Err: fmt.Errorf("execution error: User canceled. (-128)")}, Response{Kind: ResponseDismissed}, nil},
+		{"", &Error{Backend: "osascript", Kind: ErrRejected, Err: fmt.Errorf("execution error (-1728)")}, Response{}, ErrRejected},
+		{"", &Error{Backend: "osascript", Kind: ErrTimeout, Err: context.DeadlineExceeded}, Response{}, ErrTimeout},
+		{"unexpected", nil, Response{}, ErrRejected},
+	}
+	for _, tt := range tests {
+		r, err := OSAScriptResponse(n, tt.output, tt.err)
+		if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+			t.Errorf("%q, %v: error = %v, want %v", tt.output, tt.err, err, tt.wantErr)
+		}
+		if r != tt.want {
+			t.Errorf("%q, %v: response = %+v, want %+v", tt.output, tt.err, r, tt.want)
+		}
+	}
+}
+
+func TestAskPolicy(t *testing.T) {
+	var asked []string
+	setDefault(t, AskerFunc(func(ctx context.Context, n Notification) (Response, error) {
+		asked = append(asked, n.Title)
+		return Response{Kind: ResponseDismissed}, nil
+	}))
+	err := SetPolicy(PolicyOptions{Overrides: map[Severity]QuietAction{SeverityError: QuietDeliver}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDoNotDisturb(true)
+	t.Cleanup(func() {
+		SetDoNotDisturb(false)
+		SetPolicy(PolicyOptions{})
+	})
+
+	_, err = Ask(context.Background(), Notification{Title: "info"})
+	if !errors.Is(err, ErrHeld) {
+		t.Errorf("error = %v, want %v", err, ErrHeld)
+	}
+	r, err := Ask(context.Background(), Notification{Title: "error", Severity: SeverityError})
+	if err != nil || r.Kind != ResponseDismissed {
+		t.Errorf("overridden severity: response = %+v, error = %v", r, err)
+	}
+	if got := strings.Join(asked, " "); got != "error" {
+		t.Errorf("asked %q, want only the overridden severity", got)
+	}
+}
@@ -0,0 +1,371 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+func init() {
+	Register(Backend{
+		Name:      "osascript",
+		Priority:  10,
+		Available: func() bool { return runtime.GOOS == "darwin" && hasCommand("osascript") },
+		New:       func() (Notifier, error) { return Command{Build: OSAScriptArgs, Response: OSAScriptResponse}, nil },
+	})
+	Register(Backend{
+		Name:      "terminal-notifier",
+		Priority:  5,
+		Available: func() bool { return runtime.GOOS == "darwin" && hasCommand("terminal-notifier") },
+		New:       func() (Notifier, error) { return Command{Build: TerminalNotifierArgs, Replace: true}, nil },
+	})
+	Register(Backend{
+		Name:      "notify-send",
+		Priority:  10,
+		Available: func() bool { return hasCommand("notify-send") },
+		New:       func() (Notifier, error) { return Command{Build: NotifySendArgs}, nil },
+	})
+	Register(Backend{
+		Name:      "powershell",
+		Priority:  10,
+		Available: func() bool { return runtime.GOOS == "windows" && hasCommand("powershell") },
+		New:       func() (Notifier, error) { return Command{Build: PowerShellArgs, Replace: true}, nil },
+	})
+}
+
+// Shows notifications by running a command.
+//
+// Build returns the command line, starting with the executable.
+// It gets the current Config and the notification with the defaults applied.
+// Notification text must only be passed as separate arguments or properly escaped,
+// never interpolated into a script.
+//
+// If Response is set, Ask parses the user's response from the command's output.
+// Replace reports, that the command replaces the notification with the same GroupKey.
+type Command struct {
+	Build    func(cfg Config, n Notification) []string
+	Response func(n Notification, output string, err error) (Response, error)
+	Replace  bool
+}
+
+func (c Command) ReplacesGroup() bool {
+	return c.Replace
+}
+
+// Reports whether Notify waits for the user's response, like a dialog does.
+func (c Command) Interactive() bool {
+	return c.Response != nil
+}
+
+func (c Command) Notify(ctx context.Context, n Notification) error {
+	if c.Response != nil {
+		// Closing a dialog is no delivery failure
+		_, err := c.Ask(ctx, n)
+		return err
+	}
+	cfg := CurrentConfig()
+	argv := c.Build(cfg, cfg.apply(n))
+	_, err := c.run(ctx, argv)
+	return err
+}
+
+// Runs the command and returns its output.
+// Errors include the standard error output and are classified as Error.
+func (c Command) run(ctx context.Context, argv []string) (string, error) {
+	if len(argv) == 0 {
+		return "", &Error{Backend: "command", Kind: ErrRejected, Err: fmt.Errorf("empty notification command")}
+	}
+	backend := filepath.Base(argv[0])
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), commandError(ctx, backend, err)
+}
+
+// Runs the command and parses the user's response from its output.
+func (c Command) Ask(ctx context.Context, n Notification) (Response, error) {
+	if c.Response == nil {
+		return Response{}, errAskUnsupported
+	}
+	cfg := CurrentConfig()
+	n = cfg.apply(n)
+	output, err := c.run(ctx, c.Build(cfg, n))
+	if err != nil && ctx.Err() != nil {
+		return Response{}, err
+	}
+	return c.Response(n, output, err)
+}
+
+// Parses the result of a dialog shown with OSAScriptArgs,
+// e.g. `button returned:Retry, gave up:false`.
+func OSAScriptResponse(n Notification, output string, err error) (Response, error) {
+	if err != nil {
+		if errors.Is(err, ErrRejected) && strings.Contains(err.Error(), "(-128)") { // user canceled
+			return Response{Kind: ResponseDismissed}, nil
+		}
+		return Response{}, err
+	}
+	output = strings.TrimSpace(output)
+	if strings.HasSuffix(output, "gave up:true") {
+		return Response{Kind: ResponseTimeout}, nil
+	}
+	label, ok := strings.CutPrefix(output, "button returned:")
+	if !ok {
+		return Response{}, &Error{Backend: "osascript", Kind: ErrRejected, Err: fmt.Errorf("unexpected output %q", output)}
+	}
+	if i := strings.LastIndex(label, ", gave up:"); i >= 0 {
+		label = label[:i]
+	}
+	for _, a := range n.Actions {
+		if a.Label == label {
+			return Response{Kind: ResponseAction, Action: a.ID}, nil
+		}
+	}
+	return Response{Kind: ResponseDismissed}, nil // the OK button
+}
+
+// Returns the osascript command line for a dialog on macOS.
+//
+// The text is passed to the script's run handler as arguments,
+// so quotes and backslashes can't break out of the AppleScript string.
+// Actions become the dialog buttons, at most three.
+// Dialogs can't play sounds, group or tag notifications, so these are ignored.
+func OSAScriptArgs(cfg Config, n Notification) []string {
+	argv := []string{plainBody(n), cfg.AppName + " - " + n.Title}
+	item := func(s string) string {
+		argv = append(argv, s)
+		return fmt.Sprintf("(item %d of argv)", len(argv))
+	}
+	dialog := "display dialog (item 1 of argv) with title (item 2 of argv)"
+	switch {
+	case filepath.IsAbs(n.Icon):
+		dialog += " with icon (POSIX file " + item(n.Icon) + ")"
+	case n.Icon == "stop" || n.Icon == "note" || n.Icon == "caution":
+		dialog += " with icon " + n.Icon
+	case n.Severity == SeverityError || n.Urgency == UrgencyCritical:
+		dialog += " with icon stop"
+	case n.Severity == SeverityWarning:
+		dialog += " with icon caution"
+	default:
+		dialog += " with icon note"
+	}
+	if len(n.Actions) == 0 {
+		dialog += ` buttons {"OK"} default button "OK"`
+	} else {
+		actions := n.Actions[:min(len(n.Actions), 3)]
+		buttons := make([]string, len(actions))
+		for i, a := range actions {
+			buttons[i] = item(a.Label)
+		}
+		dialog += " buttons {" + strings.Join(buttons, ", ") + "} default button " + buttons[len(buttons)-1]
+	}
+	if n.Timeout > 0 {
+		dialog += fmt.Sprintf(" giving up after %d", int(math.Ceil(n.Timeout.Seconds())))
+	}
+	return append([]string{
+		"osascript",
+		"-e", "on run argv",
+		"-e", dialog,
+		"-e", "end run",
+		"--",
+	}, argv...)
+}
+
+// Returns the terminal-notifier command line for a banner on macOS.
+//
+// The group key replaces earlier banners of the same group.
+func TerminalNotifierArgs(cfg Config, n Notification) []string {
+	message := plainMessage(n)
+	if message == "" {
+		message = " " // terminal-notifier reads the message from stdin otherwise
+	}
+	argv := []string{
+		"terminal-notifier",
+		"-title", cfg.AppName + " - " + n.Title,
+		"-message", message,
+	}
+	if n.Subtitle != "" {
+		argv = append(argv, "-subtitle", n.Subtitle)
+	}
+	if filepath.IsAbs(n.Icon) {
+		argv = append(argv, "-appIcon", n.Icon)
+	}
+	if n.GroupKey != "" {
+		argv = append(argv, "-group", n.GroupKey)
+	}
+	if len(n.Actions) > 0 {
+		labels := make([]string, len(n.Actions))
+		for i, a := range n.Actions {
+			labels[i] = strings.ReplaceAll(a.Label, ",", " ") // the labels are comma separated
+		}
+		argv = append(argv, "-actions", strings.Join(labels, ","))
+	}
+	switch n.Sound {
+	case "":
+		argv = append(argv, "-sound", "default")
+	case Silent:
+	default:
+		argv = append(argv, "-sound", n.Sound)
+	}
+	return argv
+}
+
+// Returns the notify-send command line for a desktop notification on Linux.
+//
+// Notification servers interpret the body as markup, so plain text is escaped.
+// The subtitle is shown in bold above the message.
+// notify-send can only wait for actions by blocking, so they are left to the D-Bus backend.
+func NotifySendArgs(cfg Config, n Notification) []string {
+	icon := n.Icon
+	if icon == "" {
+		icon = severityIcon(n.Severity)
+	}
+	argv := []string{
+		"notify-send",
+		"--app-name=" + cfg.AppName,
+		"--urgency=" + n.Urgency.String(),
+		"--icon=" + icon,
+	}
+	if n.Timeout != 0 {
+		argv = append(argv, fmt.Sprintf("--expire-time=%d", expireTimeout(n.Timeout)))
+	}
+	switch n.Sound {
+	case "":
+	case Silent:
+		argv = append(argv, "--hint=boolean:suppress-sound:true")
+	default:
+		argv = append(argv, "--hint=string:sound-name:"+n.Sound)
+	}
+	return append(argv, "--", n.Title, markupBody(n))
+}
+
+// AppUserModelID of PowerShell, which is allowed to show toasts without registering an app.
+const powerShellAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// Returns the PowerShell command line for a toast notification on Windows.
+//
+// Toasts with the same group key replace each other.
+// The text is XML escaped, quoted as PowerShell string literal
+// and the script is passed base64 encoded, so no shell quoting is involved.
+func PowerShellArgs(cfg Config, n Notification) []string {
+	var toast strings.Builder
+	toast.WriteString("<toast")
+	if n.Urgency == UrgencyCritical {
+		toast.WriteString(` scenario="urgent"`)
+	}
+	if n.Timeout == NeverExpire || n.Timeout > 7*time.Second {
+		toast.WriteString(` duration="long"`)
+	}
+	toast.WriteString(`><visual><binding template="ToastGeneric">`)
+	fmt.Fprintf(&toast, "<text>%s</text>", html.EscapeString(n.Title))
+	if n.Subtitle != "" {
+		fmt.Fprintf(&toast, "<text>%s</text>", html.EscapeString(n.Subtitle))
+	}
+	fmt.Fprintf(&toast, "<text>%s</text>", html.EscapeString(plainMessage(n)))
+	fmt.Fprintf(&toast, `<text placement="attribution">%s</text>`, html.EscapeString(cfg.AppName))
+	if filepath.IsAbs(n.Icon) {
+		icon := (&url.URL{Scheme: "file", Path: filepath.ToSlash(n.Icon)}).String()
+		fmt.Fprintf(&toast, `<image placement="appLogoOverride" src="%s"/>`, html.EscapeString(icon))
+	}
+	toast.WriteString("</binding></visual>")
+	if len(n.Actions) > 0 {
+		toast.WriteString("<actions>")
+		for _, a := range n.Actions {
+			fmt.Fprintf(&toast, `<action content="%s" arguments="%s"/>`, html.EscapeString(a.Label), html.EscapeString(a.ID))
+		}
+		toast.WriteString("</actions>")
+	}
+	switch n.Sound {
+	case "":
+	case Silent:
+		toast.WriteString(`<audio silent="true"/>`)
+	default:
+		src := n.Sound
+		if !strings.Contains(src, ":") {
+			src = "ms-winsoundevent:Notification." + src
+		}
+		fmt.Fprintf(&toast, `<audio src="%s"/>`, html.EscapeString(src))
+	}
+	toast.WriteString("</toast>")
+
+	script := []string{
+		`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null`,
+		`[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null`,
+		`$xml = New-Object Windows.Data.Xml.Dom.XmlDocument`,
+		`$xml.LoadXml(` + powerShellString(toast.String()) + `)`,
+		`$toast = New-Object Windows.UI.Notifications.ToastNotification $xml`,
+	}
+	if n.GroupKey != "" {
+		script = append(script,
+			`$toast.Group = `+powerShellString(cfg.AppName),
+			`$toast.Tag = `+powerShellString(toastTag(n.GroupKey)),
+		)
+	}
+	script = append(script,
+		`[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(`+powerShellString(powerShellAppID)+`).Show($toast)`,
+	)
+	return []string{
+		"powershell",
+		"-NoProfile",
+		"-NonInteractive",
+		"-EncodedCommand", encodePowerShell(strings.Join(script, "\n")),
+	}
+}
+
+// Returns the toast tag for a group key. Tags are limited to 64 characters.
+func toastTag(groupKey string) string {
+	if len(groupKey) <= 64 {
+		return groupKey
+	}
+	sum := sha256.Sum256([]byte(groupKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Quotes s as a verbatim PowerShell string.
+// PowerShell treats typographic single quotes like ', so they are doubled as well.
+func powerShellString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// Encodes a script for -EncodedCommand, which expects base64 of UTF-16LE.
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// Text, which breaks out of naively quoted AppleScript, shell or PowerShell strings.
+var hostileTexts = []string{
+	`plain`,
+	`"quoted" and 'single'`,
+	`back\slash\" \\`,
+	`" & do shell script "touch /tmp/pwned" & "`,
+	`'; Remove-Item -Recurse C:\ ; '`,
+	`’smart’ quotes‘`,
+	"line\nbreak",
+	`-leading dash`,
+	`<b>tags</b> & entities &amp;`,
+	`$(command) ` + "`backtick`",
+}
+
+var testConfig = Config{AppName: "app"}
+
+// Returns the arguments after "--" and fails if there is none.
+func afterDashes(t *testing.T, argv []string) ([]string, []string) {
+	t.Helper()
+	i := slices.Index(argv, "--")
+	if i < 0 {
+		t.Fatalf("no -- in %q", argv)
+	}
+	return argv[:i], argv[i+1:]
+}
+
+func TestOSAScriptArgs(t *testing.T) {
+	for _, text := range hostileTexts {
+		n := Notification{Title: text, Message: text, Actions: []Action{{ID: "a", Label: text}, {ID: "b", Label: "OK"}}}
+		argv := OSAScriptArgs(testConfig, n)
+		if argv[0] != "osascript" {
+			t.Fatalf("executable = %q", argv[0])
+		}
+		script, args := afterDashes(t, argv)
+		for _, s := range script[1:] {
+			if s != "-e" && strings.Contains(s, text) {
+				t.Errorf("%q: text in script %q", text, s)
+			}
+		}
+		want := []string{text, "app - " + text, text, "OK"}
+		if !slices.Equal(args, want) {
+			t.Errorf("%q: argv items = %q, want %q", text, args, want)
+		}
+		if dialog := script[4]; !strings.Contains(dialog, `buttons {(item 3 of argv), (item 4 of argv)} default button (item 4 of argv)`) {
+			t.Errorf("%q: dialog = %s", text, dialog)
+		}
+	}
+}
+
+func TestOSAScriptArgsOptions(t *testing.T) {
+	tests := []struct {
+		n    Notification
+		want string
+		args []string
+	}{
+		{Notification{Title: "t"}, `with icon note buttons {"OK"} default button "OK"`, []string{"", "app - t"}},
+		{Notification{Title: "t", Severity: SeverityError}, "with icon stop", nil},
+		{Notification{Title: "t", Severity: SeverityWarning}, "with icon caution", nil},
+		{Notification{Title: "t", Icon: "/icons/a \"b\".png"}, "with icon (POSIX file (item 3 of argv))", []string{"", "app - t", "/icons/a \"b\".png"}},
+		{Notification{Title: "t", Timeout: 1500 * time.Millisecond}, "giving up after 2", nil},
+		{Notification{Title: "t", Subtitle: "s", Message: "<b>m</b>", Markup: true}, "", []string{"s\nm", "app - t"}},
+		{Notification{Title: "t", Actions: []Action{{"1", "One"}, {"2", "Two"}, {"3", "Three"}, {"4", "Four"}}},
+			"buttons {(item 3 of argv), (item 4 of argv), (item 5 of argv)}", []string{"", "app - t", "One", "Two", "Three"}},
+	}
+	for _, tt := range tests {
+		script, args := afterDashes(t, OSAScriptArgs(testConfig, tt.n))
+		if !strings.Contains(script[4], tt.want) {
+			t.Errorf("%+v: dialog = %s, want %s", tt.n, script[4], tt.want)
+		}
+		if tt.args != nil && !slices.Equal(args, tt.args) {
+			t.Errorf("%+v: argv items = %q, want %q", tt.n, args, tt.args)
+		}
+	}
+}
+
+func TestTerminalNotifierArgs(t *testing.T) {
+	for _, text := range hostileTexts {
+		n := Notification{Title: text, Subtitle: text, Message: text, GroupKey: text}
+		argv := TerminalNotifierArgs(testConfig, n)
+		want := []string{"terminal-notifier", "-title", "app - " + text, "-message", text, "-subtitle", text, "-group", text, "-sound", "default"}
+		if !slices.Equal(argv, want) {
+			t.Errorf("%q: argv = %q, want %q", text, argv, want)
+		}
+	}
+
+	argv := TerminalNotifierArgs(testConfig, Notification{Title: "t", Sound: Silent, Actions: []Action{{"a", "Yes, please"}, {"b", "No"}}})
+	want := []string{"terminal-notifier", "-title", "app - t", "-message", " ", "-actions", "Yes  please,No"}
+	if !slices.Equal(argv, want) {
+		t.Errorf("argv = %q, want %q", argv, want)
+	}
+}
+
+func TestNotifySendArgs(t *testing.T) {
+	for _, text := range hostileTexts {
+		n := Notification{Title: text, Message: text, Urgency: UrgencyNormal}
+		options, args := afterDashes(t, NotifySendArgs(testConfig, n))
+		for _, o := range options[1:] {
+			if !strings.HasPrefix(o, "--") {
+				t.Errorf("%q: option %q before -- is no flag", text, o)
+			}
+		}
+		want := []string{text, escapeMarkup(text)}
+		if !slices.Equal(args, want) {
+			t.Errorf("%q: args = %q, want %q", text, args, want)
+		}
+	}
+
+	n := Notification{Title: "-t", Subtitle: "<s>", Message: "<b>m</b>", Markup: true, Urgency: UrgencyCritical, Timeout: 3 * time.Second, Sound: "bell"}
+	argv := NotifySendArgs(testConfig, n)
+	want := []string{"notify-send", "--app-name=app", "--urgency=critical", "--icon=dialog-information", "--expire-time=3000",
+		"--hint=string:sound-name:bell", "--", "-t", "<b>&lt;s&gt;</b>\n<b>m</b>"}
+	if !slices.Equal(argv, want) {
+		t.Errorf("argv = %q, want %q", argv, want)
+	}
+}
+
+func TestPowerShellString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{``, `''`},
+		{`plain`, `'plain'`},
+		{`it's`, `'it''s'`},
+		{`’smart’ ‘quotes‘ ‚low‛`, `'’’smart’’ ‘‘quotes‘‘ ‚‚low‛‛'`},
+		{`"double" $var ` + "`tick`", `'"double" $var ` + "`tick`'"},
+		{`'; Remove-Item C:\ ; '`, `'''; Remove-Item C:\ ; '''`},
+	}
+	for _, tt := range tests {
+		if got := powerShellString(tt.in); got != tt.want {
+			t.Errorf("powerShellString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Decodes -EncodedCommand.
+func decodePowerShell(t *testing.T, encoded string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%2 != 0 {
+		t.Fatalf("odd UTF-16 length %d", len(data))
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestEncodePowerShell(t *testing.T) {
+	for _, script := range append(hostileTexts, "", "emoji 😀 outside the BMP", "äöü\r\n\t") {
+		if got := decodePowerShell(t, encodePowerShell(script)); got != script {
+			t.Errorf("round trip of %q = %q", script, got)
+		}
+	}
+}
+
+// Returns the verbatim string literals of a PowerShell script.
+func powerShellLiterals(t *testing.T, script string) []string {
+	t.Helper()
+	quote := func(r rune) bool { return strings.ContainsRune("'‘’‚‛", r) }
+	var literals []string
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		if !quote(runes[i]) {
+			continue
+		}
+		var b strings.Builder
+		for i++; ; i++ {
+			if i >= len(runes) {
+				t.Fatalf("unterminated literal in %s", script)
+			}
+			if quote(runes[i]) {
+				if i+1 < len(runes) && quote(runes[i+1]) {
+					b.WriteRune(runes[i])
+					i++
+					continue
+				}
+				break
+			}
+			b.WriteRune(runes[i])
+		}
+		literals = append(literals, b.String())
+	}
+	return literals
+}
+
+func TestPowerShellArgs(t *testing.T) {
+	for _, text := range hostileTexts {
+		n := Notification{Title: text, Subtitle: text, Message: text, GroupKey: text, Actions: []Action{{ID: text, Label: text}}}
+		argv := PowerShellArgs(testConfig, n)
+		if len(argv) != 5 || argv[3] != "-EncodedCommand" {
+			t.Fatalf("argv = %q", argv)
+		}
+		script := decodePowerShell(t, argv[4])
+		literals := powerShellLiterals(t, script)
+		// The toast XML, the group, the tag and the app ID
+		if len(literals) != 4 {
+			t.Fatalf("%q: got %d literals %q", text, len(literals), literals)
+		}
+		var toast struct {
+			Texts   []string `xml:"visual>binding>text"`
+			Actions []struct {
+				Content   string `xml:"content,attr"`
+				Arguments string `xml:"arguments,attr"`
+			} `xml:"actions>action"`
+		}
+		err := xml.Unmarshal([]byte(literals[0]), &toast)
+		if err != nil {
+			t.Fatalf("%q: invalid toast XML %s: %v", text, literals[0], err)
+		}
+		if want := []string{text, text, text, "app"}; !slices.Equal(toast.Texts, want) {
+			t.Errorf("%q: texts = %q, want %q", text, toast.Texts, want)
+		}
+		if len(toast.Actions) != 1 || toast.Actions[0].Content != text || toast.Actions[0].Arguments != text {
+			t.Errorf("%q: actions = %+v", text, toast.Actions)
+		}
+		if literals[1] != "app" || literals[2] != text || literals[3] != powerShellAppID {
+			t.Errorf("%q: literals = %q", text, literals[1:])
+		}
+	}
+
+	long := strings.Repeat("g", 65)
+	script := decodePowerShell(t, PowerShellArgs(testConfig, Notification{Title: "t", GroupKey: long})[4])
+	if tag := powerShellLiterals(t, script)[2]; tag != toastTag(long) || len(tag) != 64 {
+		t.Errorf("tag = %q, want the 64 character hash", tag)
+	}
+}
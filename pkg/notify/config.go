@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	toolio "github.com/johannes-luebke/gotool/pkg/io"
+)
+
+const (
+	NeverExpire time.Duration = -1       // Timeout, which keeps the notification until the user closes it
+	Silent                    = "silent" // Sound, which suppresses the notification sound
+)
+
+// Application wide notification defaults.
+type Config struct {
+	AppName string        // Application name shown with each notification. Defaults to the executable name
+	Icon    string        // Default icon name or absolute path. Empty picks an icon by severity
+	Urgency Urgency       // Default urgency. UrgencyDefault picks the urgency by severity
+	Timeout time.Duration // Default display time. 0 uses the platform default, NeverExpire keeps it open
+	Sound   string        // Default sound name. Empty plays the platform default, Silent plays none
+}
+
+var (
+	configMu sync.RWMutex
+	config   = Config{AppName: toolio.AppName()}
+)
+
+// Sets the application wide defaults. Call it once at startup, before sending notifications.
+func Configure(cfg Config) error {
+	if cfg.AppName == "" {
+		cfg.AppName = toolio.AppName()
+	}
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = cfg
+	return nil
+}
+
+// Returns the application wide defaults.
+func CurrentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// Checks the config for values no backend can display.
+func (c Config) Validate() error {
+	var errs []error
+	if strings.TrimSpace(c.AppName) == "" {
+		errs = append(errs, fmt.Errorf("app name cannot be empty"))
+	}
+	if strings.ContainsFunc(c.AppName, unicode.IsControl) {
+		errs = append(errs, fmt.Errorf("app name contains control characters"))
+	}
+	errs = append(errs, validateOverrides(c.Icon, c.Urgency, c.Timeout, c.Sound))
+	return errors.Join(errs...)
+}
+
+// Checks the values a notification can override.
+func validateOverrides(icon string, urgency Urgency, timeout time.Duration, sound string) error {
+	var errs []error
+	if filepath.IsAbs(icon) {
+		if _, err := os.Stat(icon); err != nil {
+			errs = append(errs, fmt.Errorf("icon: %w", err))
+		}
+	}
+	if urgency < UrgencyDefault || urgency > UrgencyCritical {
+		errs = append(errs, fmt.Errorf("invalid urgency %d", urgency))
+	}
+	if timeout < NeverExpire {
+		errs = append(errs, fmt.Errorf("invalid timeout %s", timeout))
+	}
+	if strings.ContainsFunc(sound, unicode.IsControl) {
+		errs = append(errs, fmt.Errorf("sound contains control characters"))
+	}
+	return errors.Join(errs...)
+}
+
+// Fills the unset fields of n with the application wide defaults.
+func (c Config) apply(n Notification) Notification {
+	if n.Icon == "" {
+		n.Icon = c.Icon
+	}
+	if n.Urgency == UrgencyDefault {
+		n.Urgency = c.Urgency
+	}
+	if n.Urgency == UrgencyDefault && n.Severity == SeverityError {
+		n.Urgency = UrgencyCritical
+	}
+	if n.Urgency == UrgencyDefault {
+		n.Urgency = UrgencyNormal
+	}
+	if n.Timeout == 0 {
+		n.Timeout = c.Timeout
+	}
+	if n.Sound == "" {
+		n.Sound = c.Sound
+	}
+	return n
+}
+
+// Returns n with the defaults of the current config applied.
+func withDefaults(n Notification) Notification {
+	return CurrentConfig().apply(n)
+}
@@ -0,0 +1,336 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	dbusNotificationsName = "org.freedesktop.Notifications"
+	dbusNotificationsPath = "/org/freedesktop/Notifications"
+)
+
+func init() {
+	Register(Backend{
+		Name:     "dbus",
+		Priority: 20,
+		Available: func() bool {
+			_, err := sessionBusAddress()
+			return err == nil
+		},
+		New: func() (Notifier, error) { return NewDBus("") },
+	})
+}
+
+// Shows desktop notifications via org.freedesktop.Notifications on the D-Bus session bus.
+//
+//	The connection is opened on first use and reopened after it broke.
+//	Markup and actions are only sent, if the server announces the capability.
+//	Notifications with the same group key replace each other.
+type DBus struct {
+	Address string // Bus address. Defaults to the session bus
+
+	mu     sync.Mutex
+	conn   *dbusConn
+	caps   map[string]bool   // capabilities of the notification server
+	groups map[string]uint32 // last notification ID per group key
+}
+
+// Creates a D-Bus notifier for the bus at address, or the session bus if address is empty.
+func NewDBus(address string) (*DBus, error) {
+	if address == "" {
+		var err error
+		address, err = sessionBusAddress()
+		if err != nil {
+			return nil, &Error{Backend: "dbus", Kind: ErrUnavailable, Err: err}
+		}
+	}
+	return &DBus{Address: address}, nil
+}
+
+func (d *DBus) Notify(ctx context.Context, n Notification) error {
+	_, err := d.Send(ctx, n, 0)
+	return err
+}
+
+func (d *DBus) ReplacesGroup() bool {
+	return true
+}
+
+// Shows a notification and returns its ID.
+// If replacesID is not 0, the notification with that ID is updated in place.
+func (d *DBus) Send(ctx context.Context, n Notification, replacesID uint32) (uint32, error) {
+	id, err := d.send(ctx, n, replacesID)
+	return id, dbusDeliveryError(ctx, err)
+}
+
+func (d *DBus) send(ctx context.Context, n Notification, replacesID uint32) (uint32, error) {
+	conn, caps, err := d.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cfg := CurrentConfig()
+	n = cfg.apply(n)
+	if replacesID == 0 && n.GroupKey != "" {
+		d.mu.Lock()
+		replacesID = d.groups[n.GroupKey]
+		d.mu.Unlock()
+	}
+	hints := map[string]dbusVariant{
+		"urgency": {"y", n.Urgency.dbus()},
+	}
+	switch n.Sound {
+	case "":
+	case Silent:
+		hints["suppress-sound"] = dbusVariant{"b", true}
+	default:
+		hints["sound-name"] = dbusVariant{"s", n.Sound}
+	}
+	icon := n.Icon
+	switch {
+	case icon == "":
+		icon = severityIcon(n.Severity)
+	case filepath.IsAbs(icon):
+		icon = (&url.URL{Scheme: "file", Path: icon}).String()
+	}
+	body := plainBody(n)
+	if caps["body-markup"] {
+		body = markupBody(n)
+	}
+	actions := []string{}
+	if caps["actions"] {
+		for _, a := range n.Actions {
+			actions = append(actions, a.ID, a.Label)
+		}
+	}
+	reply, err := conn.call(ctx, dbusNotificationsName, dbusNotificationsPath, dbusNotificationsName, "Notify", "susssasa{sv}i",
+		cfg.AppName, replacesID, icon, n.Title, body, actions, hints, expireTimeout(n.Timeout))
+	if err != nil {
+		d.reset(conn)
+		return 0, err
+	}
+	if len(reply) == 0 {
+		return 0, fmt.Errorf("empty reply from %s", dbusNotificationsName)
+	}
+	id, ok := reply[0].(uint32)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply from %s: %v", dbusNotificationsName, reply)
+	}
+	if n.GroupKey != "" {
+		d.mu.Lock()
+		if d.groups == nil {
+			d.groups = make(map[string]uint32)
+		}
+		d.groups[n.GroupKey] = id
+		d.mu.Unlock()
+	}
+	return id, nil
+}
+
+// Shows a notification and waits for the ActionInvoked or NotificationClosed signal.
+//
+// Clicking the notification itself is reported as action "default".
+// When ctx is done, the notification is closed.
+func (d *DBus) Ask(ctx context.Context, n Notification) (Response, error) {
+	r, err := d.ask(ctx, n)
+	return r, dbusDeliveryError(ctx, err)
+}
+
+func (d *DBus) ask(ctx context.Context, n Notification) (Response, error) {
+	conn, caps, err := d.connect(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(n.Actions) > 0 && !caps["actions"] {
+		return Response{}, errAskUnsupported
+	}
+	// Subscribe before sending, signals may arrive before the reply
+	w := &dbusWaiter{signal: make(chan *dbusMessage, 1)}
+	unsubscribe := conn.subscribe(w.handle)
+	defer unsubscribe()
+
+	id, err := d.send(ctx, n, 0)
+	if err != nil {
+		return Response{}, err
+	}
+	w.setID(id)
+	for {
+		select {
+		case m := <-w.signal:
+			switch m.Member {
+			case "ActionInvoked":
+				action, _ := m.Body[1].(string)
+				return Response{Kind: ResponseAction, Action: action}, nil
+			case "NotificationClosed":
+				if reason, _ := m.Body[1].(uint32); reason == 1 { // expired
+					return Response{Kind: ResponseTimeout}, nil
+				}
+				return Response{Kind: ResponseDismissed}, nil
+			}
+		case <-conn.closed:
+			return Response{}, conn.err
+		case <-ctx.Done():
+			closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			d.CloseNotification(closeCtx, id)
+			cancel()
+			return Response{}, ctx.Err()
+		}
+	}
+}
+
+// Picks the first ActionInvoked or NotificationClosed signal of a notification.
+// Its ID is only known after the reply to Notify, so signals received before are kept until then.
+// Signals of other notifications are dropped, however many arrive.
+type dbusWaiter struct {
+	signal chan *dbusMessage // Buffers the first matching signal
+
+	mu      sync.Mutex
+	id      uint32
+	known   bool
+	pending []*dbusMessage // signals received before the ID was known
+}
+
+// Called from the read loop.
+func (w *dbusWaiter) handle(m *dbusMessage) {
+	if m.Type != dbusSignal || m.Interface != dbusNotificationsName || len(m.Body) < 2 ||
+		(m.Member != "ActionInvoked" && m.Member != "NotificationClosed") {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.known {
+		w.pending = append(w.pending, m)
+		return
+	}
+	w.offerLocked(m)
+}
+
+func (w *dbusWaiter) setID(id uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.id, w.known = id, true
+	for _, m := range w.pending {
+		w.offerLocked(m)
+	}
+	w.pending = nil
+}
+
+// The caller must hold w.mu.
+func (w *dbusWaiter) offerLocked(m *dbusMessage) {
+	if id, _ := m.Body[0].(uint32); id != w.id {
+		return
+	}
+	select {
+	case w.signal <- m:
+	default: // a signal is waiting already
+	}
+}
+
+// Returns the expire timeout in milliseconds of the desktop notification specification.
+func expireTimeout(d time.Duration) int32 {
+	switch {
+	case d == NeverExpire:
+		return 0
+	case d > 0:
+		return int32(min(d.Milliseconds(), math.MaxInt32))
+	default:
+		return -1
+	}
+}
+
+// Closes a notification.
+func (d *DBus) CloseNotification(ctx context.Context, id uint32) error {
+	conn, _, err := d.connect(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.call(ctx, dbusNotificationsName, dbusNotificationsPath, dbusNotificationsName, "CloseNotification", "u", id)
+	return dbusDeliveryError(ctx, err)
+}
+
+// Classifies errors of the notification server.
+func dbusDeliveryError(ctx context.Context, err error) error {
+	kind := ErrTransport
+	var dbusErr *DBusError
+	if errors.As(err, &dbusErr) {
+		kind = ErrRejected
+		switch dbusErr.Name {
+		case "org.freedesktop.DBus.Error.ServiceUnknown", "org.freedesktop.DBus.Error.NameHasNoOwner":
+			kind = ErrUnavailable // no notification server running
+		}
+	}
+	return deliveryError(ctx, "dbus", kind, err)
+}
+
+// Closes the bus connection.
+func (d *DBus) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == nil {
+		return nil
+	}
+	err := d.conn.close()
+	d.conn = nil
+	return err
+}
+
+// Returns the connection and the capabilities of the notification server.
+func (d *DBus) connect(ctx context.Context) (*dbusConn, map[string]bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != nil {
+		return d.conn, d.caps, nil
+	}
+	address := d.Address
+	if address == "" {
+		var err error
+		address, err = sessionBusAddress()
+		if err != nil {
+			return nil, nil, &Error{Backend: "dbus", Kind: ErrUnavailable, Err: err}
+		}
+	}
+	conn, err := dialDBus(ctx, address)
+	if err != nil {
+		return nil, nil, deliveryError(ctx, "dbus", ErrUnavailable, err)
+	}
+	// Without capabilities, only plain text is sent
+	caps := make(map[string]bool)
+	reply, err := conn.call(ctx, dbusNotificationsName, dbusNotificationsPath, dbusNotificationsName, "GetCapabilities", "")
+	if err == nil && len(reply) > 0 {
+		list, _ := reply[0].([]any)
+		for _, c := range list {
+			if name, ok := c.(string); ok {
+				caps[name] = true
+			}
+		}
+	}
+	// Receive ActionInvoked and NotificationClosed for Ask
+	_, err = conn.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "s",
+		"type='signal',interface='"+dbusNotificationsName+"'")
+	if err != nil {
+		conn.close()
+		return nil, nil, err
+	}
+	d.conn, d.caps = conn, caps
+	return conn, caps, nil
+}
+
+// Drops a broken connection, so the next call reconnects.
+func (d *DBus) reset(conn *dbusConn) {
+	select {
+	case <-conn.closed:
+	default:
+		return // the call failed, the connection is fine
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == conn {
+		d.conn = nil
+	}
+}
@@ -0,0 +1,413 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const dbusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN" "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig><type>session</type><listen>unix:path=%s</listen><auth>EXTERNAL</auth>
+<policy context="default"><allow send_destination="*" eavesdrop="true"/><allow eavesdrop="true"/><allow own="*"/></policy></busconfig>`
+
+// Starts a private bus and returns its address. Skips the test without dbus-daemon.
+func startDBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	// Socket paths are limited to about 100 bytes, so t.TempDir may be too long
+	dir, err := os.MkdirTemp("", "dbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	config := filepath.Join(dir, "bus.conf")
+	err = os.WriteFile(config, []byte(strings.Replace(dbusConfig, "%s", filepath.Join(dir, "bus"), 1)), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon didn't print its address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// Stub notification server, which owns org.freedesktop.Notifications on the bus.
+type dbusStub struct {
+	conn   *dbusConn
+	calls  chan *dbusMessage // Notify and CloseNotification calls
+	lastID atomic.Uint32
+}
+
+func newDBusStub(t *testing.T, address string, caps ...string) *dbusStub {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := dialDBus(ctx, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.close() })
+	s := &dbusStub{conn: conn, calls: make(chan *dbusMessage, 16)}
+	conn.subscribe(func(m *dbusMessage) {
+		if m.Type != dbusMethodCall || m.Interface != dbusNotificationsName {
+			return
+		}
+		reply := &dbusMessage{Type: dbusMethodReturn, Serial: conn.serial.Add(1), ReplySerial: m.Serial, Destination: m.Sender}
+		switch m.Member {
+		case "GetCapabilities":
+			reply.Signature, reply.Body = "as", []any{append([]string{}, caps...)}
+		case "Notify":
+			id := m.Body[1].(uint32)
+			if id == 0 {
+				id = s.lastID.Add(1)
+			}
+			reply.Signature, reply.Body = "u", []any{id}
+		}
+		// Handlers must not block the read loop. Calls are reported after the reply was sent
+		go func() {
+			conn.send(reply)
+			if m.Member != "GetCapabilities" {
+				s.calls <- m
+			}
+		}()
+	})
+	reply, err := conn.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "RequestName", "su", dbusNotificationsName, uint32(0))
+	if err != nil || reply[0] != uint32(1) {
+		t.Fatalf("failed to own %s: %v %v", dbusNotificationsName, reply, err)
+	}
+	return s
+}
+
+func (s *dbusStub) nextCall(t *testing.T) *dbusMessage {
+	t.Helper()
+	select {
+	case m := <-s.calls:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a call")
+		return nil
+	}
+}
+
+func (s *dbusStub) signal(t *testing.T, member, sig string, body ...any) {
+	err := s.conn.send(&dbusMessage{
+		Type:      dbusSignal,
+		Serial:    s.conn.serial.Add(1),
+		Path:      dbusNotificationsPath,
+		Interface: dbusNotificationsName,
+		Member:    member,
+		Signature: sig,
+		Body:      body,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func newTestDBus(t *testing.T, address string) *DBus {
+	t.Helper()
+	d, err := NewDBus(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// Arguments of a Notify call with the signature susssasa{sv}i.
+type notifyArgs struct {
+	appName    string
+	replacesID uint32
+	icon       string
+	summary    string
+	body       string
+	actions    []any
+	hints      map[any]any
+	timeout    int32
+}
+
+func parseNotify(t *testing.T, m *dbusMessage) notifyArgs {
+	t.Helper()
+	if m.Member != "Notify" || m.Signature != "susssasa{sv}i" || len(m.Body) != 8 {
+		t.Fatalf("unexpected call %s(%s) %v", m.Member, m.Signature, m.Body)
+	}
+	return notifyArgs{
+		appName:    m.Body[0].(string),
+		replacesID: m.Body[1].(uint32),
+		icon:       m.Body[2].(string),
+		summary:    m.Body[3].(string),
+		body:       m.Body[4].(string),
+		actions:    m.Body[5].([]any),
+		hints:      m.Body[6].(map[any]any),
+		timeout:    m.Body[7].(int32),
+	}
+}
+
+func TestDBusNotify(t *testing.T) {
+	address := startDBus(t)
+	stub := newDBusStub(t, address, "body")
+	d := newTestDBus(t, address)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		n       Notification
+		icon    string
+		urgency byte
+		timeout int32
+		hints   map[any]any
+	}{
+		{name: "defaults", n: Notification{Title: "Info"},
+			icon: "dialog-information", urgency: 1, timeout: -1},
+		{name: "error", n: Notification{Title: "Error", Severity: SeverityError, Timeout: 5 * time.Second},
+			icon: "dialog-error", urgency: 2, timeout: 5000},
+		{name: "overrides", n: Notification{Title: "Low", Urgency: UrgencyLow, Timeout: NeverExpire, Icon: "/usr/share/icons/app icon.png", Sound: Silent},
+			icon: "file:///usr/share/icons/app%20icon.png", urgency: 0, timeout: 0,
+			hints: map[any]any{"suppress-sound": dbusVariant{"b", true}}},
+		{name: "sound", n: Notification{Title: "Sound", Sound: "bell", Severity: SeverityWarning},
+			icon: "dialog-warning", urgency: 1, timeout: -1,
+			hints: map[any]any{"sound-name": dbusVariant{"s", "bell"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := d.Send(ctx, tt.n, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := parseNotify(t, stub.nextCall(t))
+			if id != stub.lastID.Load() {
+				t.Errorf("id = %d, want %d", id, stub.lastID.Load())
+			}
+			if args.appName != CurrentConfig().AppName {
+				t.Errorf("app name = %q, want %q", args.appName, CurrentConfig().AppName)
+			}
+			if args.replacesID != 0 {
+				t.Errorf("replaces_id = %d, want 0", args.replacesID)
+			}
+			if args.icon != tt.icon {
+				t.Errorf("icon = %q, want %q", args.icon, tt.icon)
+			}
+			if args.summary != tt.n.Title {
+				t.Errorf("summary = %q, want %q", args.summary, tt.n.Title)
+			}
+			if args.timeout != tt.timeout {
+				t.Errorf("expire_timeout = %d, want %d", args.timeout, tt.timeout)
+			}
+			want := map[any]any{"urgency": dbusVariant{"y", tt.urgency}}
+			for k, v := range tt.hints {
+				want[k] = v
+			}
+			if !reflect.DeepEqual(args.hints, want) {
+				t.Errorf("hints = %v, want %v", args.hints, want)
+			}
+		})
+	}
+}
+
+func TestDBusGroupKey(t *testing.T) {
+	address := startDBus(t)
+	stub := newDBusStub(t, address)
+	d := newTestDBus(t, address)
+	ctx := context.Background()
+
+	first, err := d.Send(ctx, Notification{Title: "Downloading", GroupKey: "download"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := parseNotify(t, stub.nextCall(t)); args.replacesID != 0 {
+		t.Errorf("first replaces_id = %d, want 0", args.replacesID)
+	}
+	err = d.Notify(ctx, Notification{Title: "Other", GroupKey: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := parseNotify(t, stub.nextCall(t)); args.replacesID != 0 {
+		t.Errorf("other group replaces_id = %d, want 0", args.replacesID)
+	}
+	err = d.Notify(ctx, Notification{Title: "Downloaded", GroupKey: "download"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := parseNotify(t, stub.nextCall(t)); args.replacesID != first {
+		t.Errorf("replaces_id = %d, want %d of the same group", args.replacesID, first)
+	}
+	if !d.ReplacesGroup() {
+		t.Error("ReplacesGroup() = false")
+	}
+}
+
+func TestDBusCapabilities(t *testing.T) {
+	n := Notification{
+		Title:    "Title",
+		Subtitle: "Sub & title",
+		Message:  "<b>bold</b> &amp; plain",
+		Markup:   true,
+		Actions:  []Action{{ID: "retry", Label: "Retry"}, {ID: "ignore", Label: "Ignore"}},
+	}
+	tests := []struct {
+		name    string
+		caps    []string
+		body    string
+		actions []any
+	}{
+		{"plain", []string{"body"}, "Sub & title\nbold & plain", []any{}},
+		{"markup", []string{"body", "body-markup"}, "<b>Sub &amp; title</b>\n<b>bold</b> &amp; plain", []any{}},
+		{"actions", []string{"body", "actions"}, "Sub & title\nbold & plain", []any{"retry", "Retry", "ignore", "Ignore"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := startDBus(t)
+			stub := newDBusStub(t, address, tt.caps...)
+			d := newTestDBus(t, address)
+			err := d.Notify(context.Background(), n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := parseNotify(t, stub.nextCall(t))
+			if args.body != tt.body {
+				t.Errorf("body = %q, want %q", args.body, tt.body)
+			}
+			if !reflect.DeepEqual(args.actions, tt.actions) {
+				t.Errorf("actions = %v, want %v", args.actions, tt.actions)
+			}
+		})
+	}
+}
+
+func TestDBusAsk(t *testing.T) {
+	address := startDBus(t)
+	stub := newDBusStub(t, address, "body", "actions")
+	d := newTestDBus(t, address)
+	ctx := context.Background()
+	n := Notification{Title: "Retry?", Actions: []Action{{ID: "retry", Label: "Retry"}}}
+
+	tests := []struct {
+		name   string
+		member string
+		sig    string
+		arg    any
+		want   Response
+	}{
+		{"action", "ActionInvoked", "us", "retry", Response{Kind: ResponseAction, Action: "retry"}},
+		{"expired", "NotificationClosed", "uu", uint32(1), Response{Kind: ResponseTimeout}},
+		{"dismissed", "NotificationClosed", "uu", uint32(2), Response{Kind: ResponseDismissed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			go func() {
+				<-stub.calls
+				id := stub.lastID.Load()
+				stub.signal(t, tt.member, tt.sig, id+100, tt.arg) // another notification
+				stub.signal(t, tt.member, tt.sig, id, tt.arg)
+			}()
+			r, err := d.Ask(ctx, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != tt.want {
+				t.Errorf("response = %+v, want %+v", r, tt.want)
+			}
+		})
+	}
+
+	t.Run("flood", func(t *testing.T) {
+		go func() {
+			<-stub.calls
+			id := stub.lastID.Load()
+			for i := range 100 {
+				stub.signal(t, "NotificationClosed", "uu", id+1+uint32(i), uint32(2))
+			}
+			stub.signal(t, "ActionInvoked", "us", id, "retry")
+		}()
+		r, err := d.Ask(ctx, n)
+		if err != nil || r != (Response{Kind: ResponseAction, Action: "retry"}) {
+			t.Errorf("response = %+v, %v", r, err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			<-stub.calls
+			time.Sleep(50 * time.Millisecond) // until Ask waits for the signals
+			cancel()
+		}()
+		_, err := d.Ask(ctx, n)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+		if m := stub.nextCall(t); m.Member != "CloseNotification" || m.Body[0] != stub.lastID.Load() {
+			t.Errorf("got %s%v, want CloseNotification of %d", m.Member, m.Body, stub.lastID.Load())
+		}
+	})
+}
+
+func TestDBusServiceUnknown(t *testing.T) {
+	address := startDBus(t)
+	d := newTestDBus(t, address)
+	err := d.Notify(context.Background(), Notification{Title: "Nobody listens"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("error = %v, want ErrUnavailable", err)
+	}
+	var dbusErr *DBusError
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.DBus.Error.ServiceUnknown" {
+		t.Errorf("error = %v, want ServiceUnknown", err)
+	}
+}
+
+func TestDBusWaiter(t *testing.T) {
+	signal := func(member string, id uint32) *dbusMessage {
+		return &dbusMessage{Type: dbusSignal, Interface: dbusNotificationsName, Member: member, Body: []any{id, uint32(2)}}
+	}
+	// Signals arrive before the reply to Notify
+	w := &dbusWaiter{signal: make(chan *dbusMessage, 1)}
+	for i := range 100 {
+		w.handle(signal("NotificationClosed", uint32(i+10)))
+	}
+	w.handle(&dbusMessage{Type: dbusSignal, Interface: dbusNotificationsName, Member: "ActionInvoked", Body: []any{uint32(7)}})
+	w.handle(signal("ActivationToken", 7))
+	w.handle(signal("ActionInvoked", 7))
+	w.handle(signal("NotificationClosed", 7))
+	w.setID(7)
+	if m := <-w.signal; m.Member != "ActionInvoked" {
+		t.Errorf("got %s, want the first signal", m.Member)
+	}
+	if len(w.signal) != 0 || w.pending != nil {
+		t.Errorf("kept %d signals and %d pending", len(w.signal), len(w.pending))
+	}
+
+	// Signals arrive after the reply
+	w = &dbusWaiter{signal: make(chan *dbusMessage, 1)}
+	w.setID(7)
+	for i := range 100 {
+		w.handle(signal("NotificationClosed", uint32(i+10)))
+	}
+	w.handle(signal("NotificationClosed", 7))
+	if m := <-w.signal; m.Body[0] != uint32(7) {
+		t.Errorf("got the signal of %v", m.Body[0])
+	}
+}
@@ -0,0 +1,865 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Minimal D-Bus client, just enough for org.freedesktop.Notifications.
+// See https://dbus.freedesktop.org/doc/dbus-specification.html
+
+const (
+	dbusMethodCall   byte = 1
+	dbusMethodReturn byte = 2
+	dbusError        byte = 3
+	dbusSignal       byte = 4
+
+	dbusFieldPath        byte = 1
+	dbusFieldInterface   byte = 2
+	dbusFieldMember      byte = 3
+	dbusFieldErrorName   byte = 4
+	dbusFieldReplySerial byte = 5
+	dbusFieldDestination byte = 6
+	dbusFieldSender      byte = 7
+	dbusFieldSignature   byte = 8
+
+	dbusMaxMessageSize = 128 << 20
+)
+
+type dbusObjectPath string
+
+type dbusSignature string
+
+type dbusVariant struct {
+	Sig   string
+	Value any
+}
+
+type dbusMessage struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []any
+}
+
+// Error returned by a D-Bus method call.
+type DBusError struct {
+	Name    string
+	Message string
+}
+
+func (e *DBusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// Returns the address of the session bus.
+func sessionBusAddress() (string, error) {
+	if addr := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); addr != "" {
+		return addr, nil
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		path := filepath.Join(dir, "bus")
+		if _, err := os.Stat(path); err == nil {
+			return "unix:path=" + path, nil
+		}
+	}
+	return "", fmt.Errorf("session bus address not found")
+}
+
+// Connects to the first reachable transport of a D-Bus address,
+// e.g. `unix:path=/run/user/1000/bus` or `unix:abstract=/tmp/dbus-xyz,guid=...`.
+func dialDBusAddress(ctx context.Context, address string) (net.Conn, error) {
+	var errs []error
+	for _, transport := range strings.Split(address, ";") {
+		kind, params, ok := strings.Cut(transport, ":")
+		if !ok {
+			continue
+		}
+		values := make(map[string]string)
+		for _, kv := range strings.Split(params, ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			v, err := url.PathUnescape(v)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			values[k] = v
+		}
+		var network, addr string
+		switch {
+		case kind == "unix" && values["path"] != "":
+			network, addr = "unix", values["path"]
+		case kind == "unix" && values["abstract"] != "":
+			network, addr = "unix", "@"+values["abstract"]
+		case kind == "tcp":
+			network, addr = "tcp", net.JoinHostPort(values["host"], values["port"])
+		default:
+			errs = append(errs, fmt.Errorf("unsupported D-Bus transport %q", transport))
+			continue
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return conn, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("invalid D-Bus address %q", address)
+	}
+	return nil, errors.Join(errs...)
+}
+
+type dbusConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	wmu    sync.Mutex
+	serial atomic.Uint32
+	name   string // unique name assigned by the bus
+
+	mu       sync.Mutex
+	pending  map[uint32]chan *dbusMessage
+	handlers map[int]func(*dbusMessage)
+	nextID   int
+	err      error // set when the connection is closed
+	closed   chan struct{}
+}
+
+// Connects and authenticates to the bus at address and says Hello.
+func dialDBus(ctx context.Context, address string) (*dbusConn, error) {
+	conn, err := dialDBusAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c := &dbusConn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		pending:  make(map[uint32]chan *dbusMessage),
+		handlers: make(map[int]func(*dbusMessage)),
+		closed:   make(chan struct{}),
+	}
+	err = c.auth()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	go c.readLoop()
+
+	reply, err := c.call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", "")
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	if len(reply) > 0 {
+		c.name, _ = reply[0].(string)
+	}
+	return c, nil
+}
+
+// Authenticates with EXTERNAL, falling back to ANONYMOUS.
+func (c *dbusConn) auth() error {
+	_, err := c.conn.Write([]byte{0})
+	if err != nil {
+		return err
+	}
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	for _, mech := range []string{"EXTERNAL " + uid, "ANONYMOUS"} {
+		_, err = io.WriteString(c.conn, "AUTH "+mech+"\r\n")
+		if err != nil {
+			return err
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "OK ") {
+			_, err = io.WriteString(c.conn, "BEGIN\r\n")
+			return err
+		}
+	}
+	return fmt.Errorf("D-Bus authentication rejected")
+}
+
+// Calls a method and waits for its reply.
+func (c *dbusConn) call(ctx context.Context, dest, path, iface, member, sig string, args ...any) ([]any, error) {
+	m := &dbusMessage{
+		Type:        dbusMethodCall,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Destination: dest,
+		Signature:   sig,
+		Body:        args,
+	}
+	m.Serial = c.serial.Add(1)
+	ch := make(chan *dbusMessage, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[m.Serial] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, m.Serial)
+		c.mu.Unlock()
+	}()
+
+	err := c.send(m)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-ch:
+		if reply.Type == dbusError {
+			e := &DBusError{Name: reply.ErrorName}
+			if len(reply.Body) > 0 {
+				e.Message, _ = reply.Body[0].(string)
+			}
+			return nil, e
+		}
+		return reply.Body, nil
+	case <-c.closed:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Registers a handler for incoming signals and method calls. The returned function removes it.
+// Handlers are called from the read loop. They must not block or unsubscribe.
+func (c *dbusConn) subscribe(fn func(*dbusMessage)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	c.handlers[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.handlers, id)
+	}
+}
+
+func (c *dbusConn) send(m *dbusMessage) error {
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.conn.Write(data)
+	return err
+}
+
+func (c *dbusConn) readLoop() {
+	for {
+		m, err := readDBusMessage(c.r)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		c.mu.Lock()
+		switch m.Type {
+		case dbusMethodReturn, dbusError:
+			if ch, ok := c.pending[m.ReplySerial]; ok {
+				ch <- m
+			}
+		default:
+			for _, fn := range c.handlers {
+				fn(m)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *dbusConn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		err = fmt.Errorf("D-Bus connection closed")
+	}
+	c.err = err
+	close(c.closed)
+}
+
+func (c *dbusConn) close() error {
+	err := c.conn.Close()
+	c.shutdown(net.ErrClosed)
+	return err
+}
+
+// Marshals the message in little endian byte order.
+func (m *dbusMessage) marshal() ([]byte, error) {
+	body := &dbusEncoder{}
+	sig := m.Signature
+	for i := 0; sig != ""; i++ {
+		t, rest, err := nextDBusType(sig)
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(m.Body) {
+			return nil, fmt.Errorf("D-Bus body is missing a value for %q", t)
+		}
+		err = body.encode(t, m.Body[i])
+		if err != nil {
+			return nil, err
+		}
+		sig = rest
+	}
+
+	fields := []any{}
+	addField := func(code byte, sig string, v any) {
+		fields = append(fields, []any{code, dbusVariant{sig, v}})
+	}
+	if m.Path != "" {
+		addField(dbusFieldPath, "o", dbusObjectPath(m.Path))
+	}
+	if m.Interface != "" {
+		addField(dbusFieldInterface, "s", m.Interface)
+	}
+	if m.Member != "" {
+		addField(dbusFieldMember, "s", m.Member)
+	}
+	if m.ErrorName != "" {
+		addField(dbusFieldErrorName, "s", m.ErrorName)
+	}
+	if m.ReplySerial != 0 {
+		addField(dbusFieldReplySerial, "u", m.ReplySerial)
+	}
+	if m.Destination != "" {
+		addField(dbusFieldDestination, "s", m.Destination)
+	}
+	if m.Sender != "" {
+		addField(dbusFieldSender, "s", m.Sender)
+	}
+	if m.Signature != "" {
+		addField(dbusFieldSignature, "g", dbusSignature(m.Signature))
+	}
+
+	e := &dbusEncoder{}
+	e.buf = append(e.buf, 'l', m.Type, m.Flags, 1)
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(m.Serial)
+	err := e.encode("a(yv)", fields)
+	if err != nil {
+		return nil, err
+	}
+	e.align(8)
+	return append(e.buf, body.buf...), nil
+}
+
+func readDBusMessage(r io.Reader) (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(r, fixed)
+	if err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid D-Bus byte order %q", fixed[0])
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := (16 + int(fieldsLen) + 7) &^ 7
+	if int64(headerLen)+int64(bodyLen) > dbusMaxMessageSize {
+		return nil, fmt.Errorf("D-Bus message too large")
+	}
+	data := make([]byte, headerLen+int(bodyLen))
+	copy(data, fixed)
+	_, err = io.ReadFull(r, data[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	m := &dbusMessage{Type: fixed[1], Flags: fixed[2], Serial: order.Uint32(fixed[8:])}
+	d := &dbusDecoder{buf: data[:headerLen], pos: 12, order: order}
+	v, err := d.decode("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range v.([]any) {
+		field := f.([]any)
+		value := field[1].(dbusVariant).Value
+		switch field[0].(byte) {
+		case dbusFieldPath:
+			m.Path, _ = value.(string)
+		case dbusFieldInterface:
+			m.Interface, _ = value.(string)
+		case dbusFieldMember:
+			m.Member, _ = value.(string)
+		case dbusFieldErrorName:
+			m.ErrorName, _ = value.(string)
+		case dbusFieldReplySerial:
+			m.ReplySerial, _ = value.(uint32)
+		case dbusFieldDestination:
+			m.Destination, _ = value.(string)
+		case dbusFieldSender:
+			m.Sender, _ = value.(string)
+		case dbusFieldSignature:
+			m.Signature, _ = value.(string)
+		}
+	}
+
+	// The body is aligned relative to its own start, which is 8-byte aligned
+	d = &dbusDecoder{buf: data[headerLen:], order: order}
+	sig := m.Signature
+	for sig != "" {
+		t, rest, err := nextDBusType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(t)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = append(m.Body, v)
+		sig = rest
+	}
+	return m, nil
+}
+
+// Splits the first complete type off a signature.
+func nextDBusType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("empty D-Bus signature")
+	}
+	switch sig[0] {
+	case 'a':
+		t, rest, err := nextDBusType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + t, rest, nil
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		depth := 0
+		for i := 0; i < len(sig); i++ {
+			switch sig[i] {
+			case '(', '{':
+				depth++
+			case ')', '}':
+				depth--
+				if depth == 0 {
+					if sig[i] != end {
+						return "", "", fmt.Errorf("invalid D-Bus signature %q", sig)
+					}
+					return sig[:i+1], sig[i+1:], nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("invalid D-Bus signature %q", sig)
+	default:
+		if !strings.ContainsRune("ybnqiuxtdsogvh", rune(sig[0])) {
+			return "", "", fmt.Errorf("unsupported D-Bus type %q", sig[0])
+		}
+		return sig[:1], sig[1:], nil
+	}
+}
+
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a', 'h':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
+
+type dbusEncoder struct {
+	buf []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+// Encodes a value of a single complete type.
+func (e *dbusEncoder) encode(sig string, v any) error {
+	mismatch := func() error {
+		return fmt.Errorf("cannot encode %T as D-Bus type %q", v, sig)
+	}
+	switch sig[0] {
+	case 'y':
+		b, ok := v.(byte)
+		if !ok {
+			return mismatch()
+		}
+		e.buf = append(e.buf, b)
+	case 'b':
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		var u uint32
+		if b {
+			u = 1
+		}
+		e.uint32(u)
+	case 'n', 'q', 'i', 'u', 'x', 't', 'h':
+		rv := reflect.ValueOf(v)
+		var u uint64
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			u = uint64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u = rv.Uint()
+		default:
+			return mismatch()
+		}
+		e.align(dbusAlignment(sig[0]))
+		switch sig[0] {
+		case 'n', 'q':
+			e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(u))
+		case 'i', 'u', 'h':
+			e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(u))
+		default:
+			e.buf = binary.LittleEndian.AppendUint64(e.buf, u)
+		}
+	case 'd':
+		f, ok := v.(float64)
+		if !ok {
+			return mismatch()
+		}
+		e.align(8)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+	case 's', 'o':
+		s, ok := dbusString(v)
+		if !ok {
+			return mismatch()
+		}
+		e.uint32(uint32(len(s)))
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, 0)
+	case 'g':
+		s, ok := dbusString(v)
+		if !ok || len(s) > 255 {
+			return mismatch()
+		}
+		e.buf = append(e.buf, byte(len(s)))
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, 0)
+	case 'v':
+		variant, ok := v.(dbusVariant)
+		if !ok {
+			return mismatch()
+		}
+		err := e.encode("g", variant.Sig)
+		if err != nil {
+			return err
+		}
+		return e.encode(variant.Sig, variant.Value)
+	case '(':
+		fields, ok := v.([]any)
+		if !ok {
+			return mismatch()
+		}
+		e.align(8)
+		inner := sig[1 : len(sig)-1]
+		for i := 0; inner != ""; i++ {
+			t, rest, err := nextDBusType(inner)
+			if err != nil {
+				return err
+			}
+			if i >= len(fields) {
+				return mismatch()
+			}
+			err = e.encode(t, fields[i])
+			if err != nil {
+				return err
+			}
+			inner = rest
+		}
+	case 'a':
+		elem := sig[1:]
+		e.uint32(0) // length placeholder
+		lenPos := len(e.buf) - 4
+		e.align(dbusAlignment(elem[0]))
+		start := len(e.buf)
+		rv := reflect.ValueOf(v)
+		switch {
+		case elem[0] == '{' && rv.Kind() == reflect.Map:
+			keyType, valueType, err := nextDBusType(elem[1 : len(elem)-1])
+			if err != nil {
+				return err
+			}
+			keys := rv.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+			})
+			for _, k := range keys {
+				e.align(8)
+				err := e.encode(keyType, k.Interface())
+				if err != nil {
+					return err
+				}
+				err = e.encode(valueType, rv.MapIndex(k).Interface())
+				if err != nil {
+					return err
+				}
+			}
+		case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				err := e.encode(elem, rv.Index(i).Interface())
+				if err != nil {
+					return err
+				}
+			}
+		case v == nil:
+		default:
+			return mismatch()
+		}
+		binary.LittleEndian.PutUint32(e.buf[lenPos:], uint32(len(e.buf)-start))
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+func dbusString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case dbusObjectPath:
+		return string(s), true
+	case dbusSignature:
+		return string(s), true
+	}
+	return "", false
+}
+
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errDBusShort = errors.New("D-Bus message too short")
+
+func (d *dbusDecoder) align(n int) error {
+	d.pos = (d.pos + n - 1) / n * n
+	if d.pos > len(d.buf) {
+		return errDBusShort
+	}
+	return nil
+}
+
+func (d *dbusDecoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) || n < 0 {
+		return nil, errDBusShort
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// Decodes a value of a single complete type.
+//
+//	Basic types are returned as the matching Go type, object paths and signatures as string,
+//	variants as dbusVariant, arrays as []any, dicts as map[any]any and structs as []any.
+func (d *dbusDecoder) decode(sig string) (any, error) {
+	err := d.align(dbusAlignment(sig[0]))
+	if err != nil {
+		return nil, err
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b':
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(b) != 0, nil
+	case 'n', 'q':
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i', 'u', 'h':
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'i' {
+			return int32(d.order.Uint32(b)), nil
+		}
+		return d.order.Uint32(b), nil
+	case 'x', 't', 'd':
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		u := d.order.Uint64(b)
+		switch sig[0] {
+		case 'x':
+			return int64(u), nil
+		case 'd':
+			return math.Float64frombits(u), nil
+		}
+		return u, nil
+	case 's', 'o':
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.read(int(d.order.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.read(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		s, err := d.decode("g")
+		if err != nil {
+			return nil, err
+		}
+		variantSig := s.(string)
+		if _, rest, err := nextDBusType(variantSig); err != nil || rest != "" {
+			return nil, fmt.Errorf("invalid D-Bus variant signature %q", variantSig)
+		}
+		v, err := d.decode(variantSig)
+		if err != nil {
+			return nil, err
+		}
+		return dbusVariant{variantSig, v}, nil
+	case '(':
+		var fields []any
+		inner := sig[1 : len(sig)-1]
+		for inner != "" {
+			t, rest, err := nextDBusType(inner)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(t)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+			inner = rest
+		}
+		return fields, nil
+	case 'a':
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		n := int(d.order.Uint32(b))
+		elem := sig[1:]
+		err = d.align(dbusAlignment(elem[0]))
+		if err != nil {
+			return nil, err
+		}
+		end := d.pos + n
+		if end > len(d.buf) {
+			return nil, errDBusShort
+		}
+		if elem[0] == '{' {
+			keyType, valueType, err := nextDBusType(elem[1 : len(elem)-1])
+			if err != nil {
+				return nil, err
+			}
+			m := make(map[any]any)
+			for d.pos < end {
+				err := d.align(8)
+				if err != nil {
+					return nil, err
+				}
+				k, err := d.decode(keyType)
+				if err != nil {
+					return nil, err
+				}
+				v, err := d.decode(valueType)
+				if err != nil {
+					return nil, err
+				}
+				m[k] = v
+			}
+			return m, nil
+		}
+		values := []any{}
+		for d.pos < end {
+			v, err := d.decode(elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported D-Bus type %q", sig[0])
+}
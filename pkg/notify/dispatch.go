@@ -0,0 +1,256 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize       = 64
+	defaultWorkers         = 1
+	defaultDeliveryTimeout = 30 * time.Second
+)
+
+var (
+	ErrQueueFull = errors.New("notification queue is full")
+	ErrClosed    = errors.New("notification dispatcher is closed")
+)
+
+type DispatcherOptions struct {
+	Notifier  Notifier                        // Delivers the notifications. Defaults to the default notifier at the time of delivery, which falls back to the next backend on failure
+	QueueSize int                             // Maximum number of waiting notifications. Defaults to 64
+	Workers   int                             // Maximum number of concurrent deliveries. Defaults to 1
+	Timeout   time.Duration                   // Deadline of deliveries, whose context has none. Defaults to 30s. Not applied to Interactive notifiers, which wait for the user
+	OnResult  func(n Notification, err error) // Called after each delivery, e.g. to log failures
+	Templates *Templates                      // Templates of SendTemplate. Defaults to the ones registered with RegisterTemplate
+}
+
+// The pending result of a queued notification.
+type Delivery struct {
+	done chan struct{}
+	err  error
+}
+
+func newDelivery() *Delivery {
+	return &Delivery{done: make(chan struct{})}
+}
+
+func (d *Delivery) finish(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// Closed once the notification was delivered or failed.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Waits for the delivery and returns its error.
+// Returns ctx.Err(), if ctx is done first. The delivery itself continues.
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type dispatchJob struct {
+	ctx      context.Context
+	n        Notification
+	delivery *Delivery
+}
+
+// Delivers notifications in the background, so slow or modal backends never block the caller.
+//
+//	Notifications wait in a bounded queue. If it is full, Send fails with ErrQueueFull instead of blocking.
+//	Each notification is delivered with the context it was sent with.
+//	Notifications, whose context is done while they wait, are skipped.
+type Dispatcher struct {
+	opts  DispatcherOptions
+	queue chan dispatchJob
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	pending int           // queued and running deliveries
+	idle    chan struct{} // closed while pending is 0
+}
+
+func NewDispatcher(opts DispatcherOptions) *Dispatcher {
+	if opts.QueueSize < 1 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.Workers < 1 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultDeliveryTimeout
+	}
+	if opts.Templates == nil {
+		opts.Templates = defaultTemplates()
+	}
+	d := &Dispatcher{
+		opts:  opts,
+		queue: make(chan dispatchJob, opts.QueueSize),
+		idle:  make(chan struct{}),
+	}
+	close(d.idle)
+	d.wg.Add(opts.Workers)
+	for range opts.Workers {
+		go d.work()
+	}
+	return d
+}
+
+// Queues a notification without blocking.
+//
+// The returned Delivery reports the result. Callers, which don't care, can ignore it.
+// Invalid notifications aren't queued, their ErrRejected is reported right away.
+func (d *Dispatcher) Send(ctx context.Context, n Notification) *Delivery {
+	err := n.Validate()
+	if err != nil {
+		return d.reject(n, &Error{Backend: "dispatcher", Kind: ErrRejected, Err: err})
+	}
+	delivery := newDelivery()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		delivery.finish(ErrClosed)
+		return delivery
+	}
+	select {
+	case d.queue <- dispatchJob{ctx, n, delivery}:
+		if d.pending == 0 {
+			d.idle = make(chan struct{})
+		}
+		d.pending++
+	default:
+		delivery.finish(ErrQueueFull)
+	}
+	return delivery
+}
+
+// Renders the template registered under name and queues it like Send.
+// Render errors are reported by the returned Delivery and OnResult.
+func (d *Dispatcher) SendTemplate(ctx context.Context, name string, data any) *Delivery {
+	n, err := d.opts.Templates.Render(name, data)
+	if err != nil {
+		return d.reject(Notification{Title: name}, err)
+	}
+	return d.Send(ctx, n)
+}
+
+// Reports an error found before queueing.
+func (d *Dispatcher) reject(n Notification, err error) *Delivery {
+	if d.opts.OnResult != nil {
+		d.opts.OnResult(n, err)
+	}
+	delivery := newDelivery()
+	delivery.finish(err)
+	return delivery
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for job := range d.queue {
+		err := d.deliver(job.ctx, job.n)
+		recordHistory(job.n, err, nil)
+		if d.opts.OnResult != nil {
+			d.opts.OnResult(job.n, err)
+		}
+		job.delivery.finish(err)
+
+		d.mu.Lock()
+		d.pending--
+		if d.pending == 0 {
+			close(d.idle)
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, n Notification) error {
+	err := ctx.Err()
+	if err != nil {
+		return deliveryError(ctx, "dispatcher", ErrTimeout, err) // expired while queued
+	}
+	notifier := d.opts.Notifier
+	if notifier == nil {
+		notifier, err = Default()
+		if err != nil {
+			return err
+		}
+	}
+	// A dialog stays open until the user closes it
+	if _, ok := ctx.Deadline(); !ok && !interactive(notifier) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.opts.Timeout)
+		defer cancel()
+	}
+	return notifier.Notify(ctx, n)
+}
+
+// Waits until all queued notifications are delivered or ctx is done.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	idle := d.idle
+	d.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stops accepting notifications, delivers the queued ones and stops the workers.
+//
+// Call Flush with a deadline first to bound the shutdown time.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	return nil
+}
+
+var (
+	defaultLimiter = sync.OnceValue(func() *RateLimiter { return NewRateLimiter(nil, RateLimitOptions{}) })
+	defaultPolicy  = sync.OnceValue(func() *Policy {
+		p, _ := NewPolicy(defaultLimiter(), PolicyOptions{})
+		return p
+	})
+	defaultDispatcher = sync.OnceValue(func() *Dispatcher {
+		return NewDispatcher(DispatcherOptions{
+			Notifier: defaultPolicy(),
+			OnResult: logDeliveryError,
+		})
+	})
+)
+
+// Queues a notification for the default notifier without blocking.
+// It passes the Policy set with SetPolicy, and duplicates and floods are collapsed by a RateLimiter with the default options.
+func Send(ctx context.Context, n Notification) *Delivery {
+	return defaultDispatcher().Send(ctx, n)
+}
+
+// Waits until all notifications queued with Send and NotifyOSAsync are delivered
+// and sends the pending summaries of collapsed notifications, or until ctx is done.
+// Call it before the program exits.
+func Flush(ctx context.Context) error {
+	err := defaultDispatcher().Flush(ctx)
+	if err != nil {
+		return err
+	}
+	return defaultLimiter().Flush(ctx)
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Reports the deadline of each delivery.
+type deadlineNotifier struct {
+	interactive bool
+	deadlines   chan bool
+}
+
+func (d deadlineNotifier) Notify(ctx context.Context, n Notification) error {
+	_, ok := ctx.Deadline()
+	d.deadlines <- ok
+	return nil
+}
+
+func (d deadlineNotifier) Interactive() bool {
+	return d.interactive
+}
+
+func TestDispatcherTimeout(t *testing.T) {
+	for _, modal := range []bool{false, true} {
+		notifier := deadlineNotifier{modal, make(chan bool, 1)}
+		d := NewDispatcher(DispatcherOptions{Notifier: notifier, Timeout: time.Minute})
+		err := d.Send(context.Background(), Notification{Title: "t"}).Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deadline := <-notifier.deadlines; deadline == modal {
+			t.Errorf("interactive %v: deadline %v", modal, deadline)
+		}
+		// An explicit deadline applies to interactive notifiers, too
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		d.Send(ctx, Notification{Title: "t"}).Wait(ctx)
+		cancel()
+		if !<-notifier.deadlines {
+			t.Errorf("interactive %v: context deadline dropped", modal)
+		}
+		d.Close()
+	}
+	if !interactive(Fallback{Command{}, Command{Response: OSAScriptResponse}}) || interactive(Fallback{Command{}}) {
+		t.Error("Fallback is interactive, if any notifier is")
+	}
+}
+
+func TestDispatcherValidate(t *testing.T) {
+	var results []error
+	notifier := deadlineNotifier{false, make(chan bool, 1)}
+	d := NewDispatcher(DispatcherOptions{Notifier: notifier, OnResult: func(n Notification, err error) {
+		results = append(results, err)
+	}})
+	defer d.Close()
+	invalid := []Notification{
+		{Title: "t", Severity: SeverityError + 1},
+		{Title: "t", Actions: []Action{{ID: "a", Label: "A"}, {ID: "a", Label: "B"}}},
+		{Title: "t", Actions: []Action{{ID: "a"}}},
+	}
+	for _, n := range invalid {
+		err := d.Send(context.Background(), n).Wait(context.Background())
+		if !errors.Is(err, ErrRejected) {
+			t.Errorf("%+v: error = %v, want %v", n, err, ErrRejected)
+		}
+	}
+	if len(results) != len(invalid) || len(notifier.deadlines) != 0 {
+		t.Errorf("reported %d results and delivered %d, want %d and none", len(results), len(notifier.deadlines), len(invalid))
+	}
+}
+
+func TestNotifyOS(t *testing.T) {
+	release := make(chan struct{})
+	shown := make(chan string, 2)
+	setDefault(t, NotifierFunc(func(ctx context.Context, n Notification) error {
+		<-release
+		shown <- n.Title
+		return nil
+	}))
+
+	// NotifyOS waits for the delivery
+	done := make(chan struct{})
+	go func() {
+		NotifyOS("sync", "blocks")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("NotifyOS returned before the notification was shown")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	<-done
+	if title := <-shown; title != "sync" {
+		t.Errorf("shown %q", title)
+	}
+
+	// NotifyOSAsync only queues it
+	NotifyOSAsync("async", "queued")
+	release <- struct{}{}
+	err := Flush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := <-shown; title != "async" {
+		t.Errorf("shown %q", title)
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+
+	"github.com/johannes-luebke/gotool/pkg/log"
+)
+
+// Kinds of delivery errors. Check them with errors.Is.
+var (
+	ErrUnavailable = errors.New("backend unavailable")   // The backend doesn't work on this machine, e.g. a missing executable or bus
+	ErrTimeout     = errors.New("delivery timed out")    // The context deadline passed during delivery
+	ErrRejected    = errors.New("notification rejected") // The backend received the notification but refused or failed to show it
+	ErrTransport   = errors.New("delivery failed")       // The connection to the backend broke
+)
+
+// Returned for notifications, which were deliberately not shown, e.g. by a RateLimiter.
+// It is no delivery failure and not logged as such.
+var ErrSuppressed = errors.New("notification suppressed")
+
+// Failed delivery by a single backend.
+//
+// errors.Is matches both Kind and the underlying Err.
+type Error struct {
+	Backend string // Backend name, e.g. "dbus"
+	Kind    error  // ErrUnavailable, ErrTimeout, ErrRejected or ErrTransport
+	Err     error  // Underlying error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("notify: %s: %v: %v", e.Backend, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Wraps err of backend into an Error.
+//
+//	Errors, which are already an Error, and canceled contexts are returned unchanged.
+//	A passed deadline becomes ErrTimeout, everything else becomes kind.
+func deliveryError(ctx context.Context, backend string, kind error, err error) error {
+	var e *Error
+	switch {
+	case err == nil, errors.As(err, &e), errors.Is(err, errAskUnsupported):
+		return err
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ctx.Err()
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		kind = ErrTimeout
+	}
+	return &Error{Backend: backend, Kind: kind, Err: err}
+}
+
+// Classifies the error of a notification command.
+func commandError(ctx context.Context, backend string, err error) error {
+	kind := ErrTransport
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		kind = ErrUnavailable
+	case errors.As(err, &exitErr):
+		kind = ErrRejected
+	}
+	return deliveryError(ctx, backend, kind, err)
+}
+
+// Returns the gotool logger, or the slog default logger before log.Start.
+func logger() *slog.Logger {
+	if log.Log != nil {
+		return log.Log
+	}
+	return slog.Default()
+}
+
+// Logs a failed delivery.
+func logDeliveryError(n Notification, err error) {
+	if err != nil && !errors.Is(err, ErrSuppressed) {
+		logger().Warn("Failed to deliver notification.", "title", n.Title, "error", err)
+	}
+}
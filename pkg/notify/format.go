@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	markupEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	markupTag     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Escapes text for the body markup of desktop notifications.
+func escapeMarkup(s string) string {
+	return markupEscaper.Replace(s)
+}
+
+// Removes markup tags and resolves entities.
+func stripMarkup(s string) string {
+	return html.UnescapeString(markupTag.ReplaceAllString(s, ""))
+}
+
+// Returns the message as plain text.
+func plainMessage(n Notification) string {
+	if n.Markup {
+		return stripMarkup(n.Message)
+	}
+	return n.Message
+}
+
+// Returns the message as markup.
+func markupMessage(n Notification) string {
+	if n.Markup {
+		return n.Message
+	}
+	return escapeMarkup(n.Message)
+}
+
+// Returns the plain text message for backends without subtitles.
+//
+//	<subtitle>
+//	<message>
+func plainBody(n Notification) string {
+	return joinLines(n.Subtitle, plainMessage(n))
+}
+
+// Returns the markup message for backends without subtitles, with the subtitle in bold.
+func markupBody(n Notification) string {
+	subtitle := ""
+	if n.Subtitle != "" {
+		subtitle = "<b>" + escapeMarkup(n.Subtitle) + "</b>"
+	}
+	return joinLines(subtitle, markupMessage(n))
+}
+
+func joinLines(first, second string) string {
+	switch {
+	case first == "":
+		return second
+	case second == "":
+		return first
+	default:
+		return first + "\n" + second
+	}
+}
+
+// Returns the freedesktop icon name for the severity.
+func severityIcon(s Severity) string {
+	switch s {
+	case SeverityWarning:
+		return "dialog-warning"
+	case SeverityError:
+		return "dialog-error"
+	default:
+		return "dialog-information"
+	}
+}
@@ -0,0 +1,359 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	toolio "github.com/johannes-luebke/gotool/pkg/io"
+)
+
+const (
+	defaultHistoryMaxAge     = 30 * 24 * time.Hour
+	defaultHistoryMaxEntries = 1000
+	historyFileName          = "history.json"
+	maxHistoryLineSize       = 1 << 20
+)
+
+type DeliveryStatus string
+
+const (
+	StatusDelivered  DeliveryStatus = "delivered"  // Shown by a backend
+	StatusFailed     DeliveryStatus = "failed"     // All backends failed
+	StatusSuppressed DeliveryStatus = "suppressed" // Deliberately not shown, e.g. a duplicate
+	StatusHeld       DeliveryStatus = "held"       // Held back by a Policy during quiet hours
+)
+
+// A recorded notification.
+type HistoryEntry struct {
+	Time     time.Time      `json:"time"`
+	App      string         `json:"app"`
+	Title    string         `json:"title"`
+	Subtitle string         `json:"subtitle,omitempty"`
+	Message  string         `json:"message,omitempty"` // Plain text
+	Severity Severity       `json:"severity"`
+	Tags     []string       `json:"tags,omitempty"`
+	Group    string         `json:"group,omitempty"`
+	Status   DeliveryStatus `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Response *Response      `json:"response,omitempty"` // The user's response to Ask
+}
+
+// Returns the entry as a single line, e.g. `2024-05-01 14:03:12  ERROR    delivered  Backup failed: disk full`.
+func (e HistoryEntry) String() string {
+	line := fmt.Sprintf("%s  %-7s  %-10s  %s", e.Time.Local().Format(time.DateTime), strings.ToUpper(e.Severity.String()), e.Status, joinTerminal(terminalText(e.Title), terminalText(joinLines(e.Subtitle, e.Message))))
+	if e.Response != nil {
+		line += "  [" + e.Response.Kind.String()
+		if e.Response.Action != "" {
+			line += " " + e.Response.Action
+		}
+		line += "]"
+	}
+	if e.Error != "" {
+		line += "  (" + terminalText(e.Error) + ")"
+	}
+	return line
+}
+
+type HistoryOptions struct {
+	UserDir    string        // User directory. History is stored in <UserDir>/notify. Defaults to the state directory of AppName
+	AppName    string        // Application name used to resolve UserDir. Defaults to the executable name
+	MaxAge     time.Duration // Entries older than this are removed. Defaults to 30 days
+	MaxEntries int           // Maximum number of entries. Defaults to 1000
+}
+
+// Persistent record of notifications, one JSON object per line.
+//
+//	Entries beyond MaxAge or MaxEntries are removed when the history is opened,
+//	and whenever MaxEntries new entries were added since. Queries never return them.
+type History struct {
+	path     string
+	opts     HistoryOptions
+	readOnly bool
+
+	mu    sync.Mutex
+	added int // entries added since the last compaction
+}
+
+// Opens the history file for writing and applies the retention.
+func OpenHistory(opts HistoryOptions) (*History, error) {
+	h, err := newHistory(opts)
+	if err != nil {
+		return nil, err
+	}
+	// Create history folder if it doesn't exist
+	err = os.MkdirAll(filepath.Dir(h.path), toolio.Perm755)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err = h.compactLocked()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Opens the history file for queries, e.g. of another process.
+// Nothing is created or rewritten. A missing file is an empty history.
+func ReadHistory(opts HistoryOptions) (*History, error) {
+	h, err := newHistory(opts)
+	if err != nil {
+		return nil, err
+	}
+	h.readOnly = true
+	return h, nil
+}
+
+func newHistory(opts HistoryOptions) (*History, error) {
+	// Check history options
+	if opts.UserDir == "" {
+		if opts.AppName == "" {
+			opts.AppName = toolio.AppName()
+		}
+		dir, err := toolio.UserStateDir(opts.AppName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve user directory: %w", err)
+		}
+		opts.UserDir = dir
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultHistoryMaxAge
+	}
+	if opts.MaxEntries < 1 {
+		opts.MaxEntries = defaultHistoryMaxEntries
+	}
+	return &History{path: filepath.Join(opts.UserDir, "notify", historyFileName), opts: opts}, nil
+}
+
+// Returns the path of the history file.
+func (h *History) Path() string {
+	return h.path
+}
+
+// Appends an entry. Fails for histories opened with ReadHistory.
+func (h *History) Add(e HistoryEntry) error {
+	if h.readOnly {
+		return fmt.Errorf("history %s is opened read-only", h.path)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, toolio.Perm666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		return err
+	}
+	h.added++
+	if h.added >= h.opts.MaxEntries {
+		return h.compactLocked()
+	}
+	return nil
+}
+
+// Filters the history. Zero values match everything.
+type HistoryQuery struct {
+	Since       time.Time
+	Until       time.Time
+	MinSeverity Severity
+	Status      DeliveryStatus
+	Tag         string
+	Group       string
+	Text        string // Case-insensitive substring of the title, subtitle or message
+	Limit       int    // Maximum number of entries, newest first
+}
+
+func (q HistoryQuery) match(e HistoryEntry) bool {
+	switch {
+	case !q.Since.IsZero() && e.Time.Before(q.Since),
+		!q.Until.IsZero() && !e.Time.Before(q.Until),
+		e.Severity < q.MinSeverity,
+		q.Status != "" && e.Status != q.Status,
+		q.Group != "" && e.Group != q.Group:
+		return false
+	}
+	if q.Tag != "" {
+		found := false
+		for _, tag := range e.Tags {
+			found = found || tag == q.Tag
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Text != "" {
+		text := strings.ToLower(e.Title + "\n" + e.Subtitle + "\n" + e.Message)
+		return strings.Contains(text, strings.ToLower(q.Text))
+	}
+	return true
+}
+
+// Returns the matching entries, newest first.
+func (h *History) Query(q HistoryQuery) ([]HistoryEntry, error) {
+	h.mu.Lock()
+	entries, err := h.readLocked()
+	h.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	first := h.firstRetained(entries)
+	matches := make([]HistoryEntry, 0)
+	for i := len(entries) - 1; i >= first; i-- {
+		if q.Limit > 0 && len(matches) >= q.Limit {
+			break
+		}
+		if q.match(entries[i]) {
+			matches = append(matches, entries[i])
+		}
+	}
+	return matches, nil
+}
+
+// Returns all entries, oldest first. Lines, which can't be parsed, are skipped.
+// The caller must hold h.mu.
+func (h *History) readLocked() ([]HistoryEntry, error) {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]HistoryEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxHistoryLineSize)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Removes entries beyond MaxAge and MaxEntries.
+// The caller must hold h.mu.
+func (h *History) compactLocked() error {
+	entries, err := h.readLocked()
+	if err != nil {
+		return err
+	}
+	h.added = 0
+	first := h.firstRetained(entries)
+	if first == 0 {
+		return nil
+	}
+	// Write to a temporary file first, so a crash never loses the history
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries[first:] {
+		err := enc.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+	tmp := h.path + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), toolio.Perm666)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, h.path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Returns the index of the oldest entry within MaxAge and MaxEntries.
+func (h *History) firstRetained(entries []HistoryEntry) int {
+	cutoff := time.Now().Add(-h.opts.MaxAge)
+	first := max(len(entries)-h.opts.MaxEntries, 0)
+	for first < len(entries) && entries[first].Time.Before(cutoff) {
+		first++
+	}
+	return first
+}
+
+var history atomic.Pointer[History] // enabled history, nil if disabled
+
+// Records every notification delivered by a Dispatcher, including Send and NotifyOS, and every Ask.
+func EnableHistory(opts HistoryOptions) (*History, error) {
+	h, err := OpenHistory(opts)
+	if err != nil {
+		return nil, err
+	}
+	history.Store(h)
+	return h, nil
+}
+
+// Stops recording notifications.
+func DisableHistory() {
+	history.Store(nil)
+}
+
+// Queries the enabled history.
+func QueryHistory(q HistoryQuery) ([]HistoryEntry, error) {
+	h := history.Load()
+	if h == nil {
+		return nil, fmt.Errorf("notification history is not enabled")
+	}
+	return h.Query(q)
+}
+
+// Adds a delivery to the enabled history. Failures are logged.
+func recordHistory(n Notification, err error, response *Response) {
+	h := history.Load()
+	if h == nil {
+		return
+	}
+	e := HistoryEntry{
+		Time:     time.Now(),
+		App:      CurrentConfig().AppName,
+		Title:    n.Title,
+		Subtitle: n.Subtitle,
+		Message:  plainMessage(n),
+		Severity: n.Severity,
+		Tags:     n.Tags,
+		Group:    n.GroupKey,
+		Status:   deliveryStatus(err),
+		Response: response,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := h.Add(e); err != nil {
+		logger().Warn("Failed to record notification history.", "error", err, "history file", h.path)
+	}
+}
+
+func deliveryStatus(err error) DeliveryStatus {
+	switch {
+	case err == nil:
+		return StatusDelivered
+	case errors.Is(err, ErrHeld):
+		return StatusHeld
+	case errors.Is(err, ErrSuppressed):
+		return StatusSuppressed
+	default:
+		return StatusFailed
+	}
+}
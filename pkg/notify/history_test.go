@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadHistory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	r, err := ReadHistory(HistoryOptions{UserDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := r.Query(HistoryQuery{})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("missing history: entries = %v, error = %v", entries, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("ReadHistory created %s", dir)
+	}
+	if r.Add(HistoryEntry{Title: "t"}) == nil {
+		t.Error("Add succeeded on a read-only history")
+	}
+
+	// Entries beyond the retention are hidden, but only the writer removes them
+	opts := HistoryOptions{UserDir: dir, MaxAge: time.Hour, MaxEntries: 3}
+	w, err := OpenHistory(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	titles := []string{"old", "1", "2", "3", "4"}
+	for i, title := range titles {
+		e := HistoryEntry{Time: now.Add(time.Duration(i) * time.Minute), Title: title, Status: StatusDelivered}
+		if title == "old" {
+			e.Time = now.Add(-2 * time.Hour)
+		}
+		err := w.Add(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := os.ReadFile(w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = ReadHistory(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = r.Query(HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Title != "4" || entries[2].Title != "2" {
+		t.Errorf("entries = %v, want the newest 3", entries)
+	}
+	after, _ := os.ReadFile(r.Path())
+	if string(after) != string(before) {
+		t.Error("ReadHistory rewrote the history file")
+	}
+}
@@ -1,16 +1,221 @@
 package notify
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os/exec"
+	"strings"
+	"sync"
+	"time"
 )
 
-func NotifyOS(title string, message string) {
-	// TODO make this OS independent
-	cmd := exec.Command("osascript", "-e", fmt.Sprintf(`display dialog "%s" with title "%s" with icon caution buttons {"OK"} default button "OK"`, message, "Mapps - "+title))
-	err := cmd.Run()
+type Urgency int
+
+const (
+	UrgencyDefault Urgency = iota // Urgency of the Config
+	UrgencyLow
+	UrgencyNormal
+	UrgencyCritical
+)
+
+func (u Urgency) String() string {
+	switch u {
+	case UrgencyLow:
+		return "low"
+	case UrgencyNormal:
+		return "normal"
+	case UrgencyCritical:
+		return "critical"
+	default:
+		return "default"
+	}
+}
+
+// Returns the urgency level of the desktop notification specification.
+func (u Urgency) dbus() byte {
+	switch u {
+	case UrgencyLow:
+		return 0
+	case UrgencyCritical:
+		return 2
+	default:
+		return 1
+	}
+}
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, severity := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if strings.EqualFold(string(text), severity.String()) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Returns the plural noun for notifications of the severity, e.g. "errors".
+func (s Severity) plural() string {
+	switch s {
+	case SeverityWarning:
+		return "warnings"
+	case SeverityError:
+		return "errors"
+	default:
+		return "notifications"
+	}
+}
+
+// Button of a notification.
+type Action struct {
+	ID    string // Identifies the action in the user's response
+	Label string // Button text
+}
+
+// A notification. Backends show as much of it as they support.
+//
+//	Subtitle is merged into the message, if the backend has no subtitle.
+//	Markup is stripped, if the backend can't render it.
+//	Backends rendering markdown or HTML use the matching variant, if there is one.
+//	Actions are dropped, if the backend has no buttons.
+//	GroupKey replaces the previous notification with the same key, if the backend supports it.
+type Notification struct {
+	Title    string
+	Subtitle string
+	Message  string                // Body text
+	Markup   bool                  // Message uses markup: <b>, <i>, <u> and <a href="...">. Otherwise it is plain text
+	Variants map[TextFormat]string // Message in other formats, e.g. rendered from a Template. Backends prefer them to converting Message
+	Severity Severity              // Selects the default icon and urgency
+	Tags     []string              // Free-form tags, e.g. for filtering
+	GroupKey string                // Notifications with the same key belong together
+	Actions  []Action              // Buttons
+
+	// Overrides of the Config defaults
+	Icon    string        // Icon name or absolute path
+	Urgency Urgency       // Urgency
+	Timeout time.Duration // Display time. NeverExpire keeps it open
+	Sound   string        // Sound name. Silent plays none
+}
+
+// Checks the notification for values no backend can display.
+func (n Notification) Validate() error {
+	var errs []error
+	if n.Severity < SeverityInfo || n.Severity > SeverityError {
+		errs = append(errs, fmt.Errorf("invalid severity %d", n.Severity))
+	}
+	ids := make(map[string]bool, len(n.Actions))
+	for _, a := range n.Actions {
+		if a.ID == "" || a.Label == "" {
+			errs = append(errs, fmt.Errorf("action needs an ID and a label"))
+		}
+		if ids[a.ID] {
+			errs = append(errs, fmt.Errorf("duplicate action %q", a.ID))
+		}
+		ids[a.ID] = true
+	}
+	errs = append(errs, validateOverrides(n.Icon, n.Urgency, n.Timeout, n.Sound))
+	return errors.Join(errs...)
+}
+
+// Delivers notifications to the user.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Implemented by notifiers, which can update a shown notification.
+type Replacer interface {
+	// Reports whether a notification replaces the shown one with the same GroupKey instead of stacking.
+	ReplacesGroup() bool
+}
+
+func replacesGroup(n Notifier) bool {
+	r, ok := n.(Replacer)
+	return ok && r.ReplacesGroup()
+}
+
+// Implemented by notifiers, whose Notify can wait for the user, e.g. to close a modal dialog.
+type Interactive interface {
+	// Reports whether Notify blocks until the user reacts.
+	Interactive() bool
+}
+
+func interactive(n Notifier) bool {
+	i, ok := n.(Interactive)
+	return ok && i.Interactive()
+}
+
+// Adapts a function to the Notifier interface.
+type NotifierFunc func(ctx context.Context, n Notification) error
+
+func (f NotifierFunc) Notify(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultNotifier Notifier // detected on first use
+)
+
+// Returns the default notifier.
+//
+// On first use, the available backends are detected.
+// Notifications go to the best one and fall back to the next on failure.
+func Default() (Notifier, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultNotifier != nil {
+		return defaultNotifier, nil
+	}
+	n, err := DetectAll()
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	defaultNotifier = n
+	return n, nil
+}
+
+// Replaces the default notifier, e.g. with a mock in tests.
+func SetDefault(n Notifier) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultNotifier = n
+}
+
+// Shows a notification with the default notifier and waits until it is delivered.
+// Failures are logged.
+func NotifyOS(title string, message string) {
+	ctx := context.Background()
+	n := Notification{Title: title, Message: message}
+	err := Send(ctx, n).Wait(ctx)
+	if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrClosed) {
+		logDeliveryError(n, err) // not reported by the dispatcher
 	}
 }
+
+// Like NotifyOS, but only queues the notification without blocking.
+// Call Flush before the program exits, otherwise it may never be shown.
+func NotifyOSAsync(title string, message string) {
+	Send(context.Background(), Notification{Title: title, Message: message})
+}
@@ -0,0 +1,372 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxHeld  = 100
+	digestGroupKey  = "notify-digest"
+	digestListed    = 5 // notifications listed by title in the digest
+	maxQuietMinutes = 8 * 24 * 60
+)
+
+// Returned for notifications held back by a Policy. It matches ErrSuppressed.
+var ErrHeld = fmt.Errorf("%w: held", ErrSuppressed)
+
+// Daily period without notifications, e.g. from "22:00" to "07:00".
+// If End is before Start, the period ends on the next day. If they are equal, it lasts the whole day.
+type QuietHours struct {
+	Start string         `json:"start"`          // Clock time "HH:MM"
+	End   string         `json:"end"`            // Clock time "HH:MM"
+	Days  []time.Weekday `json:"days,omitempty"` // Days on which the period starts. Every day if empty
+}
+
+// Returns the start and end in minutes since midnight.
+func (q QuietHours) minutes() (int, int, error) {
+	parse := func(s string) (int, error) {
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid quiet hours time %q, use HH:MM", s)
+		}
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	start, err := parse(q.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parse(q.End)
+	return start, end, err
+}
+
+func (q QuietHours) startsOn(day time.Weekday) bool {
+	if len(q.Days) == 0 {
+		return true
+	}
+	for _, d := range q.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether t falls into the period. t must be in the policy's location.
+func (q QuietHours) contains(t time.Time) bool {
+	start, end, err := q.minutes()
+	if err != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	yesterday := t.AddDate(0, 0, -1).Weekday()
+	switch {
+	case start < end:
+		return q.startsOn(t.Weekday()) && minute >= start && minute < end
+	case start > end:
+		return (q.startsOn(t.Weekday()) && minute >= start) || (q.startsOn(yesterday) && minute < end)
+	default:
+		return (q.startsOn(t.Weekday()) && minute >= start) || (q.startsOn(yesterday) && minute < start)
+	}
+}
+
+// What happens to a notification during quiet hours and do not disturb.
+type QuietAction int
+
+const (
+	QuietHold    QuietAction = iota // Hold it for the digest, or drop it if Digest is disabled
+	QuietDeliver                    // Deliver it anyway
+	QuietDrop                       // Drop it
+)
+
+func (a QuietAction) String() string {
+	switch a {
+	case QuietDeliver:
+		return "deliver"
+	case QuietDrop:
+		return "drop"
+	default:
+		return "hold"
+	}
+}
+
+func (a QuietAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *QuietAction) UnmarshalText(text []byte) error {
+	for _, action := range []QuietAction{QuietHold, QuietDeliver, QuietDrop} {
+		if strings.EqualFold(string(text), action.String()) {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown quiet action %q", text)
+}
+
+type PolicyOptions struct {
+	QuietHours []QuietHours             `json:"quiet_hours,omitempty"`
+	Location   *time.Location           `json:"-"`                   // Time zone of the quiet hours. Defaults to the local time zone
+	Overrides  map[Severity]QuietAction `json:"overrides,omitempty"` // Action per severity, e.g. SeverityError: QuietDeliver. Defaults to QuietHold
+	Digest     bool                     `json:"digest"`              // Summarize held notifications, when the quiet period ends
+	MaxHeld    int                      `json:"max_held,omitempty"`  // Maximum number of held notifications. Further ones are only counted. Defaults to 100
+}
+
+// Holds back notifications during quiet hours and while do not disturb is on.
+//
+//	Severities can be overridden, e.g. to let errors through.
+//	Held notifications are summarized in a digest, once the quiet period ends or do not disturb is turned off.
+//	Held and dropped notifications return ErrHeld.
+type Policy struct {
+	notifier Notifier         // nil uses the default notifier
+	now      func() time.Time // Clock, replaced in tests
+
+	mu      sync.Mutex
+	opts    PolicyOptions
+	dnd     bool
+	held    []Notification
+	dropped int         // held notifications beyond MaxHeld
+	timer   *time.Timer // sends the digest at the end of the quiet period
+	due     time.Time   // when timer fires
+}
+
+// Wraps notifier, or the default notifier if it is nil, with a policy.
+func NewPolicy(notifier Notifier, opts PolicyOptions) (*Policy, error) {
+	p := &Policy{notifier: notifier, now: time.Now}
+	err := p.SetOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Replaces the options. Held notifications are kept.
+func (p *Policy) SetOptions(opts PolicyOptions) error {
+	var errs []error
+	for _, q := range opts.QuietHours {
+		_, _, err := q.minutes()
+		errs = append(errs, err)
+	}
+	for severity, action := range opts.Overrides {
+		if action < QuietHold || action > QuietDrop {
+			errs = append(errs, fmt.Errorf("invalid quiet action %d for %s", action, severity))
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		return err
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.MaxHeld < 1 {
+		opts.MaxHeld = defaultMaxHeld
+	}
+	p.mu.Lock()
+	p.opts = opts
+	p.scheduleLocked(p.now())
+	p.mu.Unlock()
+	return nil
+}
+
+// Turns do not disturb on or off. Turning it off sends the digest, unless quiet hours continue.
+func (p *Policy) SetDoNotDisturb(on bool) {
+	p.mu.Lock()
+	p.dnd = on
+	quiet := p.quietLocked(p.now())
+	p.mu.Unlock()
+	if !on && !quiet {
+		go p.sendDigest()
+	}
+}
+
+func (p *Policy) DoNotDisturb() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dnd
+}
+
+// Reports whether notifications are held back at t.
+func (p *Policy) Quiet(t time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.quietLocked(t)
+}
+
+// The caller must hold p.mu.
+func (p *Policy) quietLocked(t time.Time) bool {
+	return p.dnd || p.quietHoursLocked(t)
+}
+
+// The caller must hold p.mu.
+func (p *Policy) quietHoursLocked(t time.Time) bool {
+	t = t.In(p.opts.Location)
+	for _, q := range p.opts.QuietHours {
+		if q.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) Notify(ctx context.Context, n Notification) error {
+	if !p.admit(n) {
+		return ErrHeld
+	}
+	return p.deliver(ctx, n)
+}
+
+// Asks with the notifier, if it is an Asker.
+// Questions are held back like notifications, so they return ErrHeld without waiting for an answer.
+func (p *Policy) Ask(ctx context.Context, n Notification) (Response, error) {
+	if !p.admit(n) {
+		return Response{}, ErrHeld
+	}
+	notifier, err := p.resolve()
+	if err != nil {
+		return Response{}, errors.Join(errAskUnsupported, err)
+	}
+	asker, ok := notifier.(Asker)
+	if !ok {
+		return Response{}, errAskUnsupported
+	}
+	return asker.Ask(ctx, n)
+}
+
+// Reports whether n may be delivered now. Otherwise it is held or dropped.
+func (p *Policy) admit(n Notification) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.quietLocked(p.now()) {
+		return true
+	}
+	switch p.opts.Overrides[n.Severity] {
+	case QuietDeliver:
+		return true
+	case QuietHold:
+		if p.opts.Digest {
+			if len(p.held) < p.opts.MaxHeld {
+				p.held = append(p.held, n)
+			} else {
+				p.dropped++
+			}
+			if p.timer == nil {
+				p.scheduleLocked(p.now())
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) deliver(ctx context.Context, n Notification) error {
+	notifier, err := p.resolve()
+	if err != nil {
+		return err
+	}
+	return notifier.Notify(ctx, n)
+}
+
+func (p *Policy) resolve() (Notifier, error) {
+	if p.notifier != nil {
+		return p.notifier, nil
+	}
+	return Default()
+}
+
+func (p *Policy) Interactive() bool {
+	notifier, err := p.resolve()
+	return err == nil && interactive(notifier)
+}
+
+// Schedules the digest for the end of the quiet hours.
+// While do not disturb is on, the digest waits for SetDoNotDisturb(false).
+// The caller must hold p.mu.
+func (p *Policy) scheduleLocked(now time.Time) {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer, p.due = nil, time.Time{}
+	}
+	if p.dnd || (len(p.held) == 0 && p.dropped == 0) {
+		return
+	}
+	// Find the end in steps of a minute, so overlapping periods and DST changes need no special cases
+	t := now.Truncate(time.Minute)
+	for i := 0; i < maxQuietMinutes && p.quietHoursLocked(t); i++ {
+		t = t.Add(time.Minute)
+	}
+	p.timer, p.due = time.AfterFunc(t.Sub(now), p.sendDigest), t
+}
+
+func (p *Policy) sendDigest() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDeliveryTimeout)
+	defer cancel()
+	err := p.SendDigest(ctx)
+	if err != nil {
+		logDeliveryError(Notification{Title: "notification digest"}, err)
+	}
+}
+
+// Sends the digest of the held notifications now, unless it's still quiet.
+func (p *Policy) SendDigest(ctx context.Context) error {
+	p.mu.Lock()
+	if p.quietLocked(p.now()) {
+		p.scheduleLocked(p.now())
+		p.mu.Unlock()
+		return nil
+	}
+	held, dropped := p.held, p.dropped
+	p.held, p.dropped = nil, 0
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer, p.due = nil, time.Time{}
+	}
+	p.mu.Unlock()
+
+	if len(held) == 0 && dropped == 0 {
+		return nil
+	}
+	return p.deliver(ctx, digest(held, dropped))
+}
+
+// Summarizes held notifications, e.g.
+//
+//	3 notifications during quiet hours
+//	[ERROR] Backup failed
+//	[INFO] Update available
+//	…
+func digest(held []Notification, dropped int) Notification {
+	total := len(held) + dropped
+	d := Notification{
+		Title:    fmt.Sprintf("%d notifications during quiet hours", total),
+		GroupKey: digestGroupKey,
+	}
+	if total == 1 {
+		d.Title = "1 notification during quiet hours"
+	}
+	lines := make([]string, 0, digestListed+1)
+	for i, n := range held {
+		d.Severity = max(d.Severity, n.Severity)
+		if i < digestListed {
+			lines = append(lines, fmt.Sprintf("[%s] %s", strings.ToUpper(n.Severity.String()), n.Title))
+		}
+	}
+	if more := total - min(len(held), digestListed); more > 0 {
+		lines = append(lines, fmt.Sprintf("%d more", more))
+	}
+	d.Message = strings.Join(lines, "\n")
+	return d
+}
+
+// Sets the policy of Send, NotifyOS and Ask.
+func SetPolicy(opts PolicyOptions) error {
+	return defaultPolicy().SetOptions(opts)
+}
+
+// Turns do not disturb on or off for Send, NotifyOS and Ask.
+func SetDoNotDisturb(on bool) {
+	defaultPolicy().SetDoNotDisturb(on)
+}
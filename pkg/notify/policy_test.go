@@ -0,0 +1,242 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Returns a policy delivering to a channel, with a clock set by the returned function.
+func newTestPolicy(t *testing.T, opts PolicyOptions, now time.Time) (*Policy, <-chan Notification, func(time.Time)) {
+	t.Helper()
+	sent := make(chan Notification, 10)
+	p, err := NewPolicy(NotifierFunc(func(ctx context.Context, n Notification) error {
+		sent <- n
+		return nil
+	}), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The clock is read with p.mu held
+	p.now = func() time.Time { return now }
+	setClock := func(t time.Time) {
+		p.mu.Lock()
+		now = t
+		p.mu.Unlock()
+	}
+	t.Cleanup(func() {
+		p.mu.Lock()
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.mu.Unlock()
+	})
+	return p, sent, setClock
+}
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	return loc
+}
+
+func TestQuietHours(t *testing.T) {
+	loc := newYork(t)
+	// March 2026 starts on a Sunday, DST starts on the 8th
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, loc)
+	}
+	night := QuietHours{Start: "22:00", End: "07:00"}
+	friday := QuietHours{Start: "22:00", End: "07:00", Days: []time.Weekday{time.Friday}}
+	weekend := QuietHours{Start: "09:00", End: "17:00", Days: []time.Weekday{time.Saturday, time.Sunday}}
+	sunday := QuietHours{Start: "00:00", End: "00:00", Days: []time.Weekday{time.Sunday}}
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		t     time.Time
+		want  bool
+	}{
+		{"evening", night, at(2, 21, 59), false},
+		{"night", night, at(2, 22, 0), true},
+		{"after midnight", night, at(3, 6, 59), true},
+		{"morning", night, at(3, 7, 0), false},
+		{"start day", friday, at(6, 23, 0), true},
+		{"next day", friday, at(7, 6, 0), true},
+		{"other day", friday, at(7, 23, 0), false},
+		{"started the day before", friday, at(6, 6, 0), false},
+		{"weekend", weekend, at(7, 9, 0), true},
+		{"weekend evening", weekend, at(8, 17, 0), false},
+		{"weekday", weekend, at(9, 10, 0), false},
+		{"whole day", sunday, at(8, 0, 0), true},
+		{"whole day end", sunday, at(8, 23, 59), true},
+		{"day after", sunday, at(9, 0, 0), false},
+		// 07:15 UTC is 03:15 EDT, but would be 02:15 in EST
+		{"DST start", QuietHours{Start: "01:00", End: "03:00"}, time.Date(2026, time.March, 8, 7, 15, 0, 0, time.UTC), false},
+		{"DST start", QuietHours{Start: "03:00", End: "04:00"}, time.Date(2026, time.March, 8, 7, 15, 0, 0, time.UTC), true},
+		// 11:30 UTC is 06:30 EST, but would be 07:30 in EDT
+		{"DST end", night, time.Date(2026, time.November, 1, 11, 30, 0, 0, time.UTC), true},
+		{"DST end", night, time.Date(2026, time.November, 1, 12, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		p, _, _ := newTestPolicy(t, PolicyOptions{QuietHours: []QuietHours{tt.quiet}, Location: loc}, tt.t)
+		if got := p.Quiet(tt.t); got != tt.want {
+			t.Errorf("%s: %+v contains %v = %v, want %v", tt.name, tt.quiet, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestPolicySchedule(t *testing.T) {
+	loc := newYork(t)
+	tests := []struct {
+		name  string
+		quiet []QuietHours
+		now   time.Time
+		want  time.Time
+	}{
+		{"night", []QuietHours{{Start: "22:00", End: "07:00"}},
+			time.Date(2026, time.March, 2, 23, 30, 20, 0, loc), time.Date(2026, time.March, 3, 7, 0, 0, 0, loc)},
+		{"overlapping", []QuietHours{{Start: "22:00", End: "01:00"}, {Start: "00:30", End: "07:00"}},
+			time.Date(2026, time.March, 2, 23, 0, 0, 0, loc), time.Date(2026, time.March, 3, 7, 0, 0, 0, loc)},
+		{"DST start", []QuietHours{{Start: "22:00", End: "07:00"}},
+			time.Date(2026, time.March, 7, 23, 0, 0, 0, loc), time.Date(2026, time.March, 8, 7, 0, 0, 0, loc)},
+		{"not quiet", []QuietHours{{Start: "22:00", End: "07:00"}},
+			time.Date(2026, time.March, 2, 12, 0, 0, 0, loc), time.Date(2026, time.March, 2, 12, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		p, _, _ := newTestPolicy(t, PolicyOptions{QuietHours: tt.quiet, Location: loc, Digest: true}, tt.now)
+		p.mu.Lock()
+		if p.timer != nil {
+			t.Errorf("%s: scheduled without held notifications", tt.name)
+		}
+		p.held = []Notification{{Title: "t"}}
+		p.scheduleLocked(tt.now)
+		if !p.due.Equal(tt.want) {
+			t.Errorf("%s: digest due %v, want %v", tt.name, p.due, tt.want)
+		}
+		// While do not disturb is on, nothing is scheduled
+		p.dnd = true
+		p.scheduleLocked(tt.now)
+		if p.timer != nil || !p.due.IsZero() {
+			t.Errorf("%s: scheduled during do not disturb", tt.name)
+		}
+		p.mu.Unlock()
+	}
+	// The night only lasts 7 hours at the DST change
+	if got := tests[2].want.Sub(tests[2].now); got != 7*time.Hour {
+		t.Errorf("DST night lasts %v", got)
+	}
+}
+
+func TestPolicyDigest(t *testing.T) {
+	quiet := []QuietHours{{Start: "22:00", End: "07:00"}}
+	evening := time.Date(2026, time.March, 2, 21, 0, 0, 0, time.UTC)
+	opts := PolicyOptions{
+		QuietHours: quiet,
+		Location:   time.UTC,
+		Overrides:  map[Severity]QuietAction{SeverityError: QuietDeliver, SeverityWarning: QuietDrop},
+		Digest:     true,
+		MaxHeld:    2,
+	}
+	p, sent, setClock := newTestPolicy(t, opts, evening)
+	ctx := context.Background()
+	err := p.Notify(ctx, Notification{Title: "evening"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := <-sent; n.Title != "evening" {
+		t.Errorf("delivered %q", n.Title)
+	}
+
+	setClock(evening.Add(2 * time.Hour))
+	for _, title := range []string{"first", "second", "third"} {
+		err := p.Notify(ctx, Notification{Title: title})
+		if !errors.Is(err, ErrHeld) || !errors.Is(err, ErrSuppressed) {
+			t.Errorf("%s: error = %v, want %v", title, err, ErrHeld)
+		}
+	}
+	if err := p.Notify(ctx, Notification{Title: "warning", Severity: SeverityWarning}); !errors.Is(err, ErrHeld) {
+		t.Errorf("dropped: error = %v, want %v", err, ErrHeld)
+	}
+	if err := p.Notify(ctx, Notification{Title: "error", Severity: SeverityError}); err != nil {
+		t.Errorf("overridden: %v", err)
+	}
+	if n := <-sent; n.Title != "error" {
+		t.Errorf("delivered %q, want the overridden severity", n.Title)
+	}
+
+	p.mu.Lock()
+	due := p.due
+	p.mu.Unlock()
+	if want := time.Date(2026, time.March, 3, 7, 0, 0, 0, time.UTC); !due.Equal(want) {
+		t.Fatalf("digest due %v, want %v", due, want)
+	}
+	// Too early, the digest is kept
+	err = p.SendDigest(ctx)
+	if err != nil || len(sent) != 0 {
+		t.Fatalf("sent %d notifications during quiet hours, error %v", len(sent), err)
+	}
+
+	// The timer sends the digest when the quiet hours end
+	setClock(due)
+	p.sendDigest()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d notifications, want the digest", len(sent))
+	}
+	d := <-sent
+	want := Notification{
+		Title:    "3 notifications during quiet hours",
+		Message:  "[INFO] first\n[INFO] second\n1 more",
+		GroupKey: digestGroupKey,
+	}
+	if d.Title != want.Title || d.Message != want.Message || d.GroupKey != want.GroupKey {
+		t.Errorf("digest = %+v, want %+v", d, want)
+	}
+	p.sendDigest()
+	if len(sent) != 0 {
+		t.Error("sent the digest twice")
+	}
+	if err := p.Notify(ctx, Notification{Title: "morning"}); err != nil || (<-sent).Title != "morning" {
+		t.Errorf("morning: %v", err)
+	}
+}
+
+func TestPolicyDoNotDisturb(t *testing.T) {
+	p, sent, _ := newTestPolicy(t, PolicyOptions{Location: time.UTC, Digest: true}, time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+	p.SetDoNotDisturb(true)
+	if !p.DoNotDisturb() || !p.Quiet(time.Now()) {
+		t.Error("do not disturb is off")
+	}
+	err := p.Notify(ctx, Notification{Title: "held", Severity: SeverityError})
+	if !errors.Is(err, ErrHeld) {
+		t.Errorf("error = %v, want %v", err, ErrHeld)
+	}
+	p.mu.Lock()
+	if p.timer != nil {
+		t.Error("digest scheduled while do not disturb is on")
+	}
+	p.mu.Unlock()
+
+	p.SetDoNotDisturb(false)
+	d := <-sent
+	if d.Title != "1 notification during quiet hours" || d.Message != "[ERROR] held" || d.Severity != SeverityError {
+		t.Errorf("digest = %+v", d)
+	}
+	if err := p.Notify(ctx, Notification{Title: "t"}); err != nil || (<-sent).Title != "t" {
+		t.Errorf("after do not disturb: %v", err)
+	}
+
+	// Without Digest, held notifications are dropped
+	p, sent, _ = newTestPolicy(t, PolicyOptions{Location: time.UTC}, time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC))
+	p.SetDoNotDisturb(true)
+	p.Notify(ctx, Notification{Title: "dropped"})
+	p.SetDoNotDisturb(false)
+	err = p.SendDigest(ctx)
+	if err != nil || len(sent) != 0 {
+		t.Errorf("sent %d notifications without Digest, error %v", len(sent), err)
+	}
+}
@@ -0,0 +1,320 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateWindow    = time.Minute
+	defaultRatePerMinute = 10
+	droppedGroupKey      = "notify-dropped"
+)
+
+type RateLimitOptions struct {
+	Window    time.Duration // Duplicates within the window are collapsed into a summary. Defaults to 1 minute
+	PerMinute int           // Maximum number of notifications per minute. Defaults to 10, negative disables the limit
+}
+
+// Protects the user from notification floods.
+//
+//	Notifications with the same GroupKey, or the same text if they have none, are shown once per Window.
+//	Duplicates are counted and shown as a summary such as "5 more errors", once the window ends.
+//	If the notifier replaces notifications with the same GroupKey, the summary updates the shown notification
+//	and doesn't count against PerMinute. Otherwise it is shown as a new notification.
+//	Notifications beyond PerMinute are dropped and summarized as "N more notifications", once the limit allows.
+//
+// Collapsed and dropped notifications return ErrSuppressed.
+type RateLimiter struct {
+	notifier Notifier // nil uses the default notifier
+	opts     RateLimitOptions
+
+	mu      sync.Mutex
+	groups  map[string]*rateGroup
+	sent    []sentEntry // notifications shown in the last minute, oldest first
+	seq     uint64      // of the last entry in sent
+	dropped struct {
+		count    int
+		severity Severity
+		timer    *time.Timer
+	}
+}
+
+// A notification counted by the rate limit.
+type sentEntry struct {
+	seq uint64 // identifies the entry, times may be equal
+	at  time.Time
+}
+
+// Duplicates of a shown notification.
+type rateGroup struct {
+	shown time.Time
+	last  Notification // latest duplicate
+	more  int          // duplicates since shown
+	timer *time.Timer  // sends the summary at the end of the window
+}
+
+// Wraps notifier, or the default notifier if it is nil, with a rate limit.
+func NewRateLimiter(notifier Notifier, opts RateLimitOptions) *RateLimiter {
+	if opts.Window <= 0 {
+		opts.Window = defaultRateWindow
+	}
+	if opts.PerMinute == 0 {
+		opts.PerMinute = defaultRatePerMinute
+	}
+	return &RateLimiter{
+		notifier: notifier,
+		opts:     opts,
+		groups:   make(map[string]*rateGroup),
+	}
+}
+
+func (l *RateLimiter) Notify(ctx context.Context, n Notification) error {
+	notifier, err := l.resolve()
+	if err != nil {
+		return err
+	}
+	inPlace := replacesGroup(notifier)
+	key := n.GroupKey
+	if key == "" {
+		key = textKey(n)
+		if inPlace {
+			n.GroupKey = key // so the summary replaces this notification
+		}
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	l.pruneLocked(now)
+	if g := l.groups[key]; g != nil {
+		g.last = n
+		g.more++
+		if g.timer == nil {
+			g.timer = time.AfterFunc(g.shown.Add(l.opts.Window).Sub(now), func() {
+				logDeliveryError(n, l.summarize(key))
+			})
+		}
+		l.mu.Unlock()
+		return fmt.Errorf("%w: duplicate", ErrSuppressed)
+	}
+	seq, ok := l.allowLocked(now)
+	if !ok {
+		l.dropLocked(n.Severity)
+		l.mu.Unlock()
+		return fmt.Errorf("%w: rate limit exceeded", ErrSuppressed)
+	}
+	// Recorded before delivery, so concurrent duplicates are collapsed
+	g := &rateGroup{shown: now}
+	l.groups[key] = g
+	l.mu.Unlock()
+
+	err = notifier.Notify(ctx, n)
+	if err != nil {
+		l.forget(key, g, seq)
+	}
+	return err
+}
+
+// Removes a group, whose notification failed, so the next one isn't collapsed into it.
+// Duplicates collected in the meantime are kept for the summary, otherwise none of them would be shown.
+func (l *RateLimiter) forget(key string, g *rateGroup, seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.IndexFunc(l.sent, func(e sentEntry) bool { return e.seq == seq }); i >= 0 {
+		l.sent = slices.Delete(l.sent, i, i+1)
+	}
+	if l.groups[key] == g && g.more == 0 {
+		delete(l.groups, key)
+	}
+}
+
+func (l *RateLimiter) resolve() (Notifier, error) {
+	if l.notifier != nil {
+		return l.notifier, nil
+	}
+	return Default()
+}
+
+// Asks with the notifier, if it is an Asker.
+// Questions aren't limited, since each one waits for its own answer.
+func (l *RateLimiter) Ask(ctx context.Context, n Notification) (Response, error) {
+	notifier, err := l.resolve()
+	if err != nil {
+		return Response{}, errors.Join(errAskUnsupported, err)
+	}
+	asker, ok := notifier.(Asker)
+	if !ok {
+		return Response{}, errAskUnsupported
+	}
+	return asker.Ask(ctx, n)
+}
+
+func (l *RateLimiter) ReplacesGroup() bool {
+	notifier, err := l.resolve()
+	return err == nil && replacesGroup(notifier)
+}
+
+func (l *RateLimiter) Interactive() bool {
+	notifier, err := l.resolve()
+	return err == nil && interactive(notifier)
+}
+
+// Sends all pending summaries now, e.g. before the program exits.
+func (l *RateLimiter) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	var keys []string
+	for key, g := range l.groups {
+		if g.timer != nil {
+			keys = append(keys, key)
+		}
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, l.summarizeCtx(ctx, key))
+	}
+	errs = append(errs, l.summarizeDroppedCtx(ctx))
+	return errors.Join(errs...)
+}
+
+// Sends the summary of a group's duplicates and starts a new window.
+func (l *RateLimiter) summarize(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDeliveryTimeout)
+	defer cancel()
+	return l.summarizeCtx(ctx, key)
+}
+
+func (l *RateLimiter) summarizeCtx(ctx context.Context, key string) error {
+	notifier, err := l.resolve()
+	if err != nil {
+		return err
+	}
+	inPlace := replacesGroup(notifier)
+	now := time.Now()
+
+	l.mu.Lock()
+	g := l.groups[key]
+	if g == nil || g.more == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	n := g.last
+	n.Message = joinLines(n.Message, fmt.Sprintf("%d more %s", g.more, n.Severity.plural()))
+	g.shown, g.more = now, 0
+	if !inPlace {
+		if _, ok := l.allowLocked(now); !ok {
+			l.dropLocked(n.Severity)
+			l.mu.Unlock()
+			return nil
+		}
+	}
+	l.mu.Unlock()
+
+	return notifier.Notify(ctx, n)
+}
+
+// Sends the summary of the notifications dropped by the rate limit.
+func (l *RateLimiter) summarizeDropped() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDeliveryTimeout)
+	defer cancel()
+	return l.summarizeDroppedCtx(ctx)
+}
+
+func (l *RateLimiter) summarizeDroppedCtx(ctx context.Context) error {
+	notifier, err := l.resolve()
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	if l.dropped.timer != nil {
+		l.dropped.timer.Stop()
+		l.dropped.timer = nil
+	}
+	if l.dropped.count == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	n := Notification{
+		Title:    fmt.Sprintf("%d more notifications", l.dropped.count),
+		Message:  "Some notifications were not shown, because there were too many.",
+		Severity: l.dropped.severity,
+		GroupKey: droppedGroupKey,
+	}
+	l.dropped.count, l.dropped.severity = 0, SeverityInfo
+	l.recordLocked(time.Now())
+	l.mu.Unlock()
+
+	return notifier.Notify(ctx, n)
+}
+
+// Reports whether the rate limit allows another notification and records it.
+// Returns the sequence number of the recorded entry, if any.
+// The caller must hold l.mu.
+func (l *RateLimiter) allowLocked(now time.Time) (uint64, bool) {
+	if l.opts.PerMinute < 0 {
+		return 0, true
+	}
+	if len(l.sent) >= l.opts.PerMinute {
+		return 0, false
+	}
+	return l.recordLocked(now), true
+}
+
+// Counts a notification shown at now against the rate limit and returns its sequence number.
+// The caller must hold l.mu.
+func (l *RateLimiter) recordLocked(now time.Time) uint64 {
+	l.seq++
+	l.sent = append(l.sent, sentEntry{l.seq, now})
+	return l.seq
+}
+
+// Counts a notification dropped by the rate limit and schedules the summary.
+// The caller must hold l.mu.
+func (l *RateLimiter) dropLocked(severity Severity) {
+	l.dropped.count++
+	l.dropped.severity = max(l.dropped.severity, severity)
+	if l.dropped.timer == nil {
+		wait := time.Minute
+		if len(l.sent) > 0 {
+			wait = time.Until(l.sent[0].at.Add(time.Minute))
+		}
+		l.dropped.timer = time.AfterFunc(wait, func() {
+			logDeliveryError(Notification{Title: "dropped notifications"}, l.summarizeDropped())
+		})
+	}
+}
+
+// Forgets notifications older than the rate limit and the window.
+// The caller must hold l.mu.
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	i := 0
+	for i < len(l.sent) && now.Sub(l.sent[i].at) >= time.Minute {
+		i++
+	}
+	l.sent = l.sent[i:]
+	for key, g := range l.groups {
+		if g.timer == nil && now.Sub(g.shown) >= l.opts.Window {
+			delete(l.groups, key)
+		}
+	}
+}
+
+// Returns a group key for notifications without one, based on their text.
+func textKey(n Notification) string {
+	h := fnv.New64a()
+	for _, s := range []string{n.Title, n.Subtitle, n.Message} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("notify-%016x", h.Sum64())
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterForgetsFailures(t *testing.T) {
+	failing := true
+	var shown []string
+	notifier := NotifierFunc(func(ctx context.Context, n Notification) error {
+		if failing {
+			return &Error{Backend: "stub", Kind: ErrTransport, Err: errors.New("broken pipe")}
+		}
+		shown = append(shown, n.Title)
+		return nil
+	})
+	l := NewRateLimiter(notifier, RateLimitOptions{Window: time.Hour, PerMinute: 1})
+	ctx := context.Background()
+
+	err := l.Notify(ctx, Notification{Title: "a"})
+	if !errors.Is(err, ErrTransport) {
+		t.Fatalf("error = %v, want %v", err, ErrTransport)
+	}
+	// Neither the group nor the rate limit remember the failed notification
+	failing = false
+	err = l.Notify(ctx, Notification{Title: "a"})
+	if err != nil {
+		t.Errorf("retry after failure: %v", err)
+	}
+	err = l.Notify(ctx, Notification{Title: "a"})
+	if !errors.Is(err, ErrSuppressed) {
+		t.Errorf("duplicate after success: error = %v, want %v", err, ErrSuppressed)
+	}
+	if len(shown) != 1 || shown[0] != "a" {
+		t.Errorf("shown = %q, want the retry", shown)
+	}
+}
+
+// Records shown notifications. ReplacesGroup reports inPlace.
+type recordingNotifier struct {
+	inPlace bool
+	shown   *[]Notification
+}
+
+func (r recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	*r.shown = append(*r.shown, n)
+	return nil
+}
+
+func (r recordingNotifier) ReplacesGroup() bool {
+	return r.inPlace
+}
+
+func TestRateLimiterDuplicates(t *testing.T) {
+	for _, inPlace := range []bool{false, true} {
+		var shown []Notification
+		l := NewRateLimiter(recordingNotifier{inPlace, &shown}, RateLimitOptions{Window: time.Hour, PerMinute: 2})
+		ctx := context.Background()
+		for i := range 4 {
+			err := l.Notify(ctx, Notification{Title: "disk full", Message: "/var", Severity: SeverityError})
+			if (i == 0) != (err == nil) || (i > 0 && !errors.Is(err, ErrSuppressed)) {
+				t.Errorf("inPlace %v: notification %d: error = %v", inPlace, i, err)
+			}
+		}
+		err := l.Flush(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shown) != 2 {
+			t.Fatalf("inPlace %v: shown %d notifications, want it and the summary", inPlace, len(shown))
+		}
+		summary := shown[1]
+		if summary.Title != "disk full" || summary.Message != "/var\n3 more errors" || summary.GroupKey != shown[0].GroupKey {
+			t.Errorf("inPlace %v: summary = %+v", inPlace, summary)
+		}
+		if (summary.GroupKey != "") != inPlace {
+			t.Errorf("inPlace %v: GroupKey = %q", inPlace, summary.GroupKey)
+		}
+		// A summary replacing the notification doesn't count against PerMinute
+		want := 2
+		if inPlace {
+			want = 1
+		}
+		if len(l.sent) != want {
+			t.Errorf("inPlace %v: %d counted against the rate limit, want %d", inPlace, len(l.sent), want)
+		}
+		// The summary starts a new window
+		err = l.Notify(ctx, Notification{Title: "disk full", Message: "/var", Severity: SeverityError})
+		if !errors.Is(err, ErrSuppressed) {
+			t.Errorf("inPlace %v: error = %v, want %v", inPlace, err, ErrSuppressed)
+		}
+	}
+}
+
+func TestRateLimiterDropped(t *testing.T) {
+	var shown []Notification
+	l := NewRateLimiter(recordingNotifier{false, &shown}, RateLimitOptions{PerMinute: 2})
+	ctx := context.Background()
+	for _, n := range []Notification{{Title: "a"}, {Title: "b"}, {Title: "c"}, {Title: "d", Severity: SeverityWarning}, {Title: "e"}} {
+		err := l.Notify(ctx, n)
+		if dropped := n.Title > "b"; dropped != errors.Is(err, ErrSuppressed) {
+			t.Errorf("%s: error = %v", n.Title, err)
+		}
+	}
+	if len(shown) != 2 {
+		t.Fatalf("shown %d notifications, want 2", len(shown))
+	}
+	err := l.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Notification{
+		Title:    "3 more notifications",
+		Message:  "Some notifications were not shown, because there were too many.",
+		Severity: SeverityWarning,
+		GroupKey: droppedGroupKey,
+	}
+	if len(shown) != 3 || shown[2].Title != want.Title || shown[2].Message != want.Message ||
+		shown[2].Severity != want.Severity || shown[2].GroupKey != want.GroupKey {
+		t.Errorf("shown %+v, want the summary %+v", shown[2:], want)
+	}
+	// The summary counts against the limit, too
+	if len(l.sent) != 3 {
+		t.Errorf("%d counted against the rate limit, want 3", len(l.sent))
+	}
+	if err := l.Flush(ctx); err != nil || len(shown) != 3 {
+		t.Errorf("sent the summary twice: %v", err)
+	}
+}
+
+func TestRateLimiterForgetEqualTimes(t *testing.T) {
+	l := NewRateLimiter(NotifierFunc(func(ctx context.Context, n Notification) error { return nil }), RateLimitOptions{})
+	now := time.Now()
+	l.mu.Lock()
+	first, _ := l.allowLocked(now)
+	second, _ := l.allowLocked(now)
+	l.mu.Unlock()
+	l.forget("key", &rateGroup{}, second)
+	if len(l.sent) != 1 || l.sent[0].seq != first {
+		t.Errorf("sent = %v, want only the first entry", l.sent)
+	}
+	l.forget("key", &rateGroup{}, second)
+	if len(l.sent) != 1 {
+		t.Errorf("forgot another entry: %v", l.sent)
+	}
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type Backend struct {
+	Name      string                   // Unique name, e.g. "osascript"
+	Priority  int                      // Detect prefers backends with a higher priority
+	Available func() bool              // Reports whether the backend works on this machine
+	New       func() (Notifier, error) // Creates the notifier
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Backend)
+)
+
+// Registers a backend. A backend with the same name is replaced.
+func Register(b Backend) {
+	if b.Name == "" || b.New == nil {
+		panic("notify: backend needs a name and a constructor")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[b.Name] = b
+}
+
+// Returns the registered backends, highest priority first.
+func Backends() []Backend {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	backends := make([]Backend, 0, len(registry))
+	for _, b := range registry {
+		backends = append(backends, b)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		if backends[i].Priority != backends[j].Priority {
+			return backends[i].Priority > backends[j].Priority
+		}
+		return backends[i].Name < backends[j].Name
+	})
+	return backends
+}
+
+// Returns the backend registered under name.
+func Lookup(name string) (Backend, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	b, ok := registry[name]
+	return b, ok
+}
+
+// Creates a notifier for the backend registered under name.
+func New(name string) (Notifier, error) {
+	b, ok := Lookup(name)
+	if !ok {
+		return nil, &Error{Backend: name, Kind: ErrUnavailable, Err: fmt.Errorf("unknown notification backend %q", name)}
+	}
+	return b.New()
+}
+
+// Creates a notifier for the best available backend.
+func Detect() (Notifier, error) {
+	notifiers, err := DetectAll()
+	if err != nil {
+		return nil, err
+	}
+	return notifiers[0], nil
+}
+
+// Creates notifiers for all available backends, best first.
+func DetectAll() (Fallback, error) {
+	var notifiers Fallback
+	for _, b := range Backends() {
+		if b.Available != nil && !b.Available() {
+			continue
+		}
+		n, err := b.New()
+		if err != nil {
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifiers) == 0 {
+		return nil, &Error{Backend: "detect", Kind: ErrUnavailable, Err: fmt.Errorf("no notification backend available")}
+	}
+	return notifiers, nil
+}
+
+// Tries notifiers in order until one delivers the notification.
+//
+// It moves on to the next notifier after any error,
+// except when the context is done, since later notifiers would fail as well.
+// The errors of all tried notifiers are joined.
+type Fallback []Notifier
+
+func (f Fallback) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range f {
+		err := notifier.Notify(ctx, n)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reports whether the preferred notifier replaces notifications with the same GroupKey.
+func (f Fallback) ReplacesGroup() bool {
+	return len(f) > 0 && replacesGroup(f[0])
+}
+
+// Reports whether any notifier waits for the user.
+func (f Fallback) Interactive() bool {
+	for _, notifier := range f {
+		if interactive(notifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// Asks with the first notifier, which can wait for a response.
+//
+// If no notifier succeeds, the error matches errAskUnsupported,
+// so Ask falls back to the terminal prompt.
+func (f Fallback) Ask(ctx context.Context, n Notification) (Response, error) {
+	errs := []error{errAskUnsupported}
+	for _, notifier := range f {
+		asker, ok := notifier.(Asker)
+		if !ok {
+			continue
+		}
+		r, err := asker.Ask(ctx, n)
+		if err == nil {
+			return r, nil
+		}
+		if errors.Is(err, errAskUnsupported) {
+			continue
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			return Response{}, errors.Join(errs[1:]...)
+		}
+	}
+	return Response{}, errors.Join(errs...)
+}
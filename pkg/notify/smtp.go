@@ -0,0 +1,407 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SMTPSecurity int
+
+const (
+	SMTPStartTLS    SMTPSecurity = iota // Upgrade the connection with STARTTLS. Fails if the server doesn't offer it
+	SMTPImplicitTLS                     // Connect with TLS, usually on port 465
+	SMTPInsecure                        // Plain text connection, e.g. to a local relay. Authentication is refused
+)
+
+func (s SMTPSecurity) String() string {
+	switch s {
+	case SMTPImplicitTLS:
+		return "tls"
+	case SMTPInsecure:
+		return "insecure"
+	default:
+		return "starttls"
+	}
+}
+
+func (s SMTPSecurity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *SMTPSecurity) UnmarshalText(text []byte) error {
+	for _, security := range []SMTPSecurity{SMTPStartTLS, SMTPImplicitTLS, SMTPInsecure} {
+		if strings.EqualFold(string(text), security.String()) {
+			*s = security
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown SMTP security %q", text)
+}
+
+type SMTPAuth int
+
+const (
+	SMTPAuthAuto  SMTPAuth = iota // PLAIN if the server offers it, otherwise LOGIN
+	SMTPAuthPlain                 // AUTH PLAIN
+	SMTPAuthLogin                 // AUTH LOGIN
+)
+
+func (a SMTPAuth) String() string {
+	switch a {
+	case SMTPAuthPlain:
+		return "plain"
+	case SMTPAuthLogin:
+		return "login"
+	default:
+		return "auto"
+	}
+}
+
+func (a SMTPAuth) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *SMTPAuth) UnmarshalText(text []byte) error {
+	for _, auth := range []SMTPAuth{SMTPAuthAuto, SMTPAuthPlain, SMTPAuthLogin} {
+		if strings.EqualFold(string(text), auth.String()) {
+			*a = auth
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown SMTP auth %q", text)
+}
+
+// SMTP settings, e.g. from a config file.
+//
+// Password can reference a secret like WebhookConfig.URL, e.g. `env:SMTP_PASSWORD`.
+type SMTPConfig struct {
+	Host       string                `json:"host"`
+	Port       int                   `json:"port,omitempty"` // Defaults to 587, or 465 with SMTPImplicitTLS
+	Security   SMTPSecurity          `json:"security"`
+	Auth       SMTPAuth              `json:"auth"`
+	Username   string                `json:"username,omitempty"` // No authentication if empty
+	Password   string                `json:"password,omitempty"`
+	From       string                `json:"from"`
+	To         []string              `json:"to,omitempty"`         // Recipients of all severities without an entry in Recipients
+	Recipients map[Severity][]string `json:"recipients,omitempty"` // Recipients per severity. An empty list sends no email for the severity
+	TLSConfig  *tls.Config           `json:"-"`                    // TLS settings. Defaults to verifying the certificate of Host
+}
+
+// Sends notifications as email.
+//
+//	The message is a multipart email with a plain text and an HTML part.
+//	Critical notifications are marked as high priority.
+//	Actions are dropped, since the user's response can't be received.
+type SMTP struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	// Check SMTP config
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host cannot be empty")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.Security == SMTPImplicitTLS {
+			cfg.Port = 465
+		}
+	}
+	if cfg.Security < SMTPStartTLS || cfg.Security > SMTPInsecure {
+		return nil, fmt.Errorf("invalid SMTP security %d", cfg.Security)
+	}
+	if cfg.Auth < SMTPAuthAuto || cfg.Auth > SMTPAuthLogin {
+		return nil, fmt.Errorf("invalid SMTP auth %d", cfg.Auth)
+	}
+	if cfg.Username != "" {
+		if cfg.Security == SMTPInsecure {
+			return nil, fmt.Errorf("SMTP authentication requires TLS")
+		}
+		password, err := resolveSecret(cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP password: %w", err)
+		}
+		cfg.Password = password
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP sender: %w", err)
+	}
+	lists := [][]string{cfg.To}
+	for _, list := range cfg.Recipients {
+		lists = append(lists, list)
+	}
+	for _, list := range lists {
+		for _, to := range list {
+			_, err := mail.ParseAddress(to)
+			if err != nil {
+				return nil, fmt.Errorf("SMTP recipient %q: %w", to, err)
+			}
+		}
+	}
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host}
+	}
+	return &SMTP{cfg: cfg, from: from}, nil
+}
+
+// Returns the recipients for the severity.
+func (s *SMTP) recipients(severity Severity) []string {
+	if to, ok := s.cfg.Recipients[severity]; ok {
+		return to
+	}
+	return s.cfg.To
+}
+
+// Mails the notification to the recipients of its severity.
+// Severities without recipients are skipped.
+func (s *SMTP) Notify(ctx context.Context, n Notification) error {
+	to := s.recipients(n.Severity)
+	if len(to) == 0 {
+		return nil
+	}
+	cfg := CurrentConfig()
+	msg, err := s.message(cfg, cfg.apply(n), to)
+	if err != nil {
+		return &Error{Backend: "smtp", Kind: ErrRejected, Err: err}
+	}
+	return smtpError(ctx, s.send(ctx, to, msg))
+}
+
+// Delivers msg over a new connection.
+func (s *SMTP) send(ctx context.Context, to []string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Abort blocking reads and writes, when ctx is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if s.cfg.Security == SMTPImplicitTLS {
+		tlsConn := tls.Client(conn, s.cfg.TLSConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if s.cfg.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return &Error{Backend: "smtp", Kind: ErrRejected, Err: fmt.Errorf("server doesn't support STARTTLS")}
+		}
+		err = c.StartTLS(s.cfg.TLSConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		err = c.Auth(s.auth(c))
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Mail(s.from.Address)
+	if err != nil {
+		return err
+	}
+	for _, addr := range to {
+		rcpt, _ := mail.ParseAddress(addr)
+		err = c.Rcpt(rcpt.Address)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Returns the authentication mechanism for the server.
+func (s *SMTP) auth(c *smtp.Client) smtp.Auth {
+	plain := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	login := &loginAuth{s.cfg.Username, s.cfg.Password, s.cfg.Host}
+	switch s.cfg.Auth {
+	case SMTPAuthPlain:
+		return plain
+	case SMTPAuthLogin:
+		return login
+	}
+	_, mechanisms := c.Extension("AUTH")
+	for _, m := range strings.Fields(mechanisms) {
+		if strings.EqualFold(m, "PLAIN") {
+			return plain
+		}
+	}
+	return login
+}
+
+// Implements AUTH LOGIN, which net/smtp lacks.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like smtp.PlainAuth, never send the password unencrypted
+	if !server.TLS {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+// Classifies SMTP errors. Permanent 5xx replies are ErrRejected, everything else ErrTransport.
+func smtpError(ctx context.Context, err error) error {
+	kind := ErrTransport
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		kind = ErrRejected
+	}
+	return deliveryError(ctx, "smtp", kind, err)
+}
+
+// Returns the email for the notification.
+func (s *SMTP) message(cfg Config, n Notification, to []string) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	header := [][2]string{
+		{"From", s.from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", oneLine(fmt.Sprintf("[%s] %s", cfg.AppName, n.Title)))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(s.from.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+		{"Auto-Submitted", "auto-generated"},
+	}
+	if n.Urgency == UrgencyCritical {
+		header = append(header, [2]string{"X-Priority", "1"}, [2]string{"Importance", "high"})
+	}
+	for _, h := range header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", mailText(cfg, n)},
+		{"text/html; charset=utf-8", mailHTML(cfg, n)},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := parts.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Replaces line breaks, so a value can't inject headers.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func messageID(from string) string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	domain := "localhost"
+	if at := strings.LastIndexByte(from, '@'); at >= 0 {
+		domain = from[at+1:]
+	}
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
+
+func mailText(cfg Config, n Notification) string {
+	text := joinLines(n.Title, plainBody(n))
+	if len(n.Tags) > 0 {
+		text += "\n\nTags: " + strings.Join(n.Tags, ", ")
+	}
+	text = strings.ReplaceAll(text+"\n\n-- \n"+cfg.AppName+"\n", "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "\r\n")
+}
+
+func mailHTML(cfg Config, n Notification) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><body style=\"font-family: sans-serif\">\n")
+	fmt.Fprintf(&b, "<h2 style=\"border-left: 4px solid #%06X; padding-left: 8px\">%s</h2>\n", severityColor(n.Severity), html.EscapeString(n.Title))
+	if n.Subtitle != "" {
+		fmt.Fprintf(&b, "<p><b>%s</b></p>\n", html.EscapeString(n.Subtitle))
+	}
+	if text, ok := n.Variants[TextHTML]; ok {
+		b.WriteString(text + "\n")
+	} else if n.Message != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\n", strings.ReplaceAll(markupMessage(n), "\n", "<br>\n"))
+	}
+	footer := html.EscapeString(cfg.AppName)
+	if len(n.Tags) > 0 {
+		footer += " &middot; " + html.EscapeString(strings.Join(n.Tags, ", "))
+	}
+	fmt.Fprintf(&b, "<p style=\"color: #888; font-size: small\">%s</p>\n</body></html>\n", footer)
+	return b.String()
+}
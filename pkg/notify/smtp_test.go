@@ -0,0 +1,524 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mail received by smtpStub.
+type smtpMail struct {
+	tls  bool
+	auth []string // mechanism, username and password
+	from string
+	to   []string
+	data string
+}
+
+// Minimal SMTP server, which accepts every mail except for recipients containing "reject".
+type smtpStub struct {
+	startTLS bool   // offers STARTTLS
+	auth     string // mechanisms offered after TLS, e.g. "PLAIN LOGIN"
+	tls      *tls.Config
+	mails    chan smtpMail
+}
+
+// Generates a self signed certificate for 127.0.0.1 and returns the server and client configs.
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
+
+// Starts the stub and returns the port. With implicitTLS, connections start with the TLS handshake.
+func (s *smtpStub) start(t *testing.T, implicitTLS bool) int {
+	t.Helper()
+	s.mails = make(chan smtpMail, 10)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicitTLS {
+		l = tls.NewListener(l, s.tls)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn, implicitTLS)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+var smtpAddress = regexp.MustCompile(`<([^>]*)>`)
+
+func (s *smtpStub) serve(t *testing.T, conn net.Conn, secure bool) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	var m smtpMail
+	m.tls = secure
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			text.PrintfLine("%s", line)
+		}
+	}
+	read := func() string {
+		line, _ := text.ReadLine()
+		return line
+	}
+	decode := func(s string) string {
+		data, _ := base64.StdEncoding.DecodeString(s)
+		return string(data)
+	}
+	reply("220 stub ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			ext := []string{"stub", "8BITMIME"}
+			if s.startTLS && !m.tls {
+				ext = append(ext, "STARTTLS")
+			}
+			if s.auth != "" && m.tls {
+				ext = append(ext, "AUTH "+s.auth)
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				reply("250" + sep + e)
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, text, m.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			switch mechanism {
+			case "PLAIN":
+				if initial == "" {
+					reply("334 ")
+					initial = read()
+				}
+				fields := strings.Split(decode(initial), "\x00")
+				m.auth = append([]string{"PLAIN"}, fields[1:]...)
+			case "LOGIN":
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				username := decode(read())
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				m.auth = []string{"LOGIN", username, decode(read())}
+			default:
+				reply("504 unknown mechanism")
+				continue
+			}
+			reply("235 authenticated")
+		case "MAIL":
+			m.from = smtpAddress.FindStringSubmatch(arg)[1]
+			reply("250 ok")
+		case "RCPT":
+			to := smtpAddress.FindStringSubmatch(arg)[1]
+			if strings.Contains(to, "reject") {
+				reply("550 no such user")
+				continue
+			}
+			m.to = append(m.to, to)
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			// Unlike ReadDotBytes, keeps the line breaks as sent
+			var data strings.Builder
+			for {
+				line, err := text.R.ReadString('\n')
+				if err != nil {
+					t.Errorf("failed to read data: %v", err)
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			m.data = data.String()
+			reply("250 queued")
+			s.mails <- m
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func newTestSMTP(t *testing.T, port int, client *tls.Config, cfg SMTPConfig) *SMTP {
+	t.Helper()
+	cfg.Host, cfg.Port, cfg.TLSConfig = "127.0.0.1", port, client
+	if cfg.From == "" {
+		cfg.From = "Backup <backup@example.com>"
+	}
+	if cfg.To == nil && cfg.Recipients == nil {
+		cfg.To = []string{"admin@example.com"}
+	}
+	s, err := NewSMTP(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSMTPStartTLS(t *testing.T) {
+	server, client := testTLSConfigs(t)
+	stub := &smtpStub{startTLS: true, auth: "PLAIN LOGIN", tls: server}
+	port := stub.start(t, false)
+	s := newTestSMTP(t, port, client, SMTPConfig{Username: "user", Password: "secret", To: []string{"Admin <admin@example.com>", "ops@example.com"}})
+	err := s.Notify(context.Background(), Notification{Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := <-stub.mails
+	if !m.tls {
+		t.Error("mail sent without TLS")
+	}
+	if want := []string{"PLAIN", "user", "secret"}; !slices.Equal(m.auth, want) {
+		t.Errorf("auth = %q, want %q", m.auth, want)
+	}
+	if m.from != "backup@example.com" || !slices.Equal(m.to, []string{"admin@example.com", "ops@example.com"}) {
+		t.Errorf("envelope from %q to %q", m.from, m.to)
+	}
+
+	// A server without STARTTLS never sees the credentials
+	stub = &smtpStub{auth: "PLAIN", tls: server}
+	port = stub.start(t, false)
+	s = newTestSMTP(t, port, client, SMTPConfig{Username: "user", Password: "secret"})
+	err = s.Notify(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("error = %v, want %v for the missing STARTTLS", err, ErrRejected)
+	}
+	if len(stub.mails) != 0 {
+		t.Error("mail sent without STARTTLS")
+	}
+
+	// An untrusted certificate
+	stub = &smtpStub{startTLS: true, tls: server}
+	port = stub.start(t, false)
+	s = newTestSMTP(t, port, &tls.Config{ServerName: "127.0.0.1"}, SMTPConfig{})
+	err = s.Notify(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrTransport) {
+		t.Errorf("untrusted certificate: error = %v, want %v", err, ErrTransport)
+	}
+}
+
+func TestSMTPSecurity(t *testing.T) {
+	server, client := testTLSConfigs(t)
+	stub := &smtpStub{auth: "PLAIN", tls: server}
+	port := stub.start(t, true)
+	err := newTestSMTP(t, port, client, SMTPConfig{Security: SMTPImplicitTLS, Username: "user", Password: "secret"}).Notify(context.Background(), Notification{Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := <-stub.mails; !m.tls || len(m.auth) == 0 {
+		t.Errorf("implicit TLS: tls %v, auth %q", m.tls, m.auth)
+	}
+
+	stub = &smtpStub{}
+	port = stub.start(t, false)
+	err = newTestSMTP(t, port, nil, SMTPConfig{Security: SMTPInsecure}).Notify(context.Background(), Notification{Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := <-stub.mails; m.tls {
+		t.Error("insecure connection used TLS")
+	}
+	_, err = NewSMTP(SMTPConfig{Host: "127.0.0.1", Security: SMTPInsecure, Username: "user", Password: "secret", From: "a@example.com"})
+	if err == nil {
+		t.Error("authentication allowed without TLS")
+	}
+}
+
+func TestSMTPAuth(t *testing.T) {
+	server, client := testTLSConfigs(t)
+	tests := []struct {
+		offered string
+		auth    SMTPAuth
+		want    string
+	}{
+		{"PLAIN LOGIN", SMTPAuthAuto, "PLAIN"},
+		{"LOGIN", SMTPAuthAuto, "LOGIN"},
+		{"LOGIN PLAIN", SMTPAuthLogin, "LOGIN"},
+		{"PLAIN LOGIN", SMTPAuthPlain, "PLAIN"},
+	}
+	for _, tt := range tests {
+		stub := &smtpStub{startTLS: true, auth: tt.offered, tls: server}
+		port := stub.start(t, false)
+		t.Setenv("TEST_SMTP_PASSWORD", "p@ss word")
+		s := newTestSMTP(t, port, client, SMTPConfig{Auth: tt.auth, Username: "user@example.com", Password: "env:TEST_SMTP_PASSWORD"})
+		err := s.Notify(context.Background(), Notification{Title: "t"})
+		if err != nil {
+			t.Errorf("%s offering %s: %v", tt.auth, tt.offered, err)
+			continue
+		}
+		if got, want := (<-stub.mails).auth, []string{tt.want, "user@example.com", "p@ss word"}; !slices.Equal(got, want) {
+			t.Errorf("%s offering %s: auth = %q, want %q", tt.auth, tt.offered, got, want)
+		}
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	a := &loginAuth{"user", "secret", "mail.example.com"}
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Error("LOGIN allowed without TLS")
+	}
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "evil.example.com", TLS: true}); err == nil {
+		t.Error("LOGIN allowed for the wrong host")
+	}
+	mechanism, initial, err := a.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true})
+	if err != nil || mechanism != "LOGIN" || initial != nil {
+		t.Errorf("Start = %q, %q, %v", mechanism, initial, err)
+	}
+	for challenge, want := range map[string]string{"Username:": "user", "password:": "secret", " USERNAME ": "user"} {
+		if got, err := a.Next([]byte(challenge), true); err != nil || string(got) != want {
+			t.Errorf("Next(%q) = %q, %v, want %q", challenge, got, err, want)
+		}
+	}
+	if _, err := a.Next([]byte("Token:"), true); err == nil {
+		t.Error("unexpected challenge answered")
+	}
+	if got, err := a.Next(nil, false); got != nil || err != nil {
+		t.Errorf("Next after success = %q, %v", got, err)
+	}
+}
+
+func TestSMTPRecipients(t *testing.T) {
+	stub := &smtpStub{}
+	port := stub.start(t, false)
+	s := newTestSMTP(t, port, nil, SMTPConfig{
+		Security:   SMTPInsecure,
+		To:         []string{"all@example.com"},
+		Recipients: map[Severity][]string{SeverityError: {"oncall@example.com", "lead@example.com"}, SeverityInfo: {}},
+	})
+	tests := []struct {
+		severity Severity
+		want     []string
+	}{
+		{SeverityError, []string{"oncall@example.com", "lead@example.com"}},
+		{SeverityWarning, []string{"all@example.com"}},
+		{SeverityInfo, nil},
+	}
+	for _, tt := range tests {
+		err := s.Notify(context.Background(), Notification{Title: "t", Severity: tt.severity})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.severity, err)
+		}
+		if tt.want == nil {
+			if len(stub.mails) != 0 {
+				t.Errorf("%s: mail sent to an empty list", tt.severity)
+			}
+			continue
+		}
+		m := <-stub.mails
+		if !slices.Equal(m.to, tt.want) {
+			t.Errorf("%s: sent to %q, want %q", tt.severity, m.to, tt.want)
+		}
+		msg, err := mail.ReadMessage(strings.NewReader(m.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if to := msg.Header.Get("To"); to != strings.Join(tt.want, ", ") {
+			t.Errorf("%s: To = %q", tt.severity, to)
+		}
+	}
+
+	_, err := NewSMTP(SMTPConfig{Host: "127.0.0.1", From: "a@example.com", Recipients: map[Severity][]string{SeverityError: {"not an address"}}})
+	if err == nil {
+		t.Error("invalid recipient accepted")
+	}
+	err = newTestSMTP(t, port, nil, SMTPConfig{Security: SMTPInsecure, To: []string{"reject@example.com"}}).Notify(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "550") {
+		t.Errorf("rejected recipient: error = %v, want %v", err, ErrRejected)
+	}
+}
+
+// Returns the decoded parts of a multipart message with their raw headers.
+func mailParts(t *testing.T, msg *mail.Message) ([]textproto.MIMEHeader, []string) {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var headers []textproto.MIMEHeader
+	var bodies []string
+	for {
+		part, err := r.NextRawPart()
+		if err == io.EOF {
+			return headers, bodies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(raw), "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("quoted-printable line longer than 76 characters: %q", line)
+			}
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, part.Header)
+		bodies = append(bodies, string(body))
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	stub := &smtpStub{}
+	port := stub.start(t, false)
+	s := newTestSMTP(t, port, nil, SMTPConfig{Security: SMTPInsecure})
+	app := CurrentConfig().AppName
+	n := Notification{
+		Title:    "Backup <failed> für db",
+		Subtitle: "Nightly",
+		Message:  "<b>Disk</b> full.\n" + strings.Repeat("long line ", 20) + "= end",
+		Markup:   true,
+		Severity: SeverityError,
+		Tags:     []string{"db"},
+	}
+	err := s.Notify(context.Background(), n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader((<-stub.mails).data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "["+app+"] Backup <failed> für db" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	for key, want := range map[string]string{"From": `"Backup" <backup@example.com>`, "MIME-Version": "1.0", "X-Priority": "1", "Importance": "high", "Auto-Submitted": "auto-generated"} {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	headers, bodies := mailParts(t, msg)
+	if len(bodies) != 2 {
+		t.Fatalf("got %d parts, want text and HTML", len(bodies))
+	}
+	for i, contentType := range []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"} {
+		if got := headers[i].Get("Content-Type"); got != contentType {
+			t.Errorf("part %d: Content-Type = %q, want %q", i, got, contentType)
+		}
+		if got := headers[i].Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+			t.Errorf("part %d: Content-Transfer-Encoding = %q", i, got)
+		}
+	}
+	text := "Backup <failed> für db\r\nNightly\r\nDisk full.\r\n" + strings.Repeat("long line ", 20) + "= end\r\n\r\nTags: db\r\n\r\n-- \r\n" + app + "\r\n"
+	if bodies[0] != text {
+		t.Errorf("text = %q, want %q", bodies[0], text)
+	}
+	for _, want := range []string{"<h2 style=\"border-left: 4px solid #D93F0B; padding-left: 8px\">Backup &lt;failed&gt; für db</h2>", "<p><b>Nightly</b></p>", "<p><b>Disk</b> full.<br>\r\nlong line", "&middot; db"} {
+		if !strings.Contains(bodies[1], want) {
+			t.Errorf("HTML lacks %q:\n%s", want, bodies[1])
+		}
+	}
+}
+
+func TestSMTPHeaderInjection(t *testing.T) {
+	stub := &smtpStub{}
+	port := stub.start(t, false)
+	s := newTestSMTP(t, port, nil, SMTPConfig{Security: SMTPInsecure})
+	for _, title := range []string{"t\r\nBcc: victim@example.com", "t\nBcc: victim@example.com", "t\rBcc: victim@example.com", "t\r\n\r\nbody"} {
+		err := s.Notify(context.Background(), Notification{Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := <-stub.mails
+		msg, err := mail.ReadMessage(strings.NewReader(m.data))
+		if err != nil {
+			t.Fatalf("%q: %v", title, err)
+		}
+		if bcc := msg.Header.Get("Bcc"); bcc != "" || len(m.to) != 1 {
+			t.Errorf("%q: injected Bcc %q, recipients %q", title, bcc, m.to)
+		}
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if strings.ContainsAny(subject, "\r\n") || !strings.HasPrefix(subject, "["+CurrentConfig().AppName+"] t ") {
+			t.Errorf("%q: Subject = %q", title, subject)
+		}
+		headers, _ := mailParts(t, msg)
+		if len(headers) != 2 {
+			t.Errorf("%q: got %d parts", title, len(headers))
+		}
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	for in, want := range map[string]string{"a\r\nb": "a b", " a \t b\n": "a b", "a\u2028b": "a b", "": ""} {
+		if got := oneLine(in); got != want {
+			t.Errorf("oneLine(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
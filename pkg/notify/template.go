@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Format of a message variant.
+type TextFormat int
+
+const (
+	TextMarkdown TextFormat = iota // Markdown for Discord and Teams webhooks
+	TextSlack                      // Slack's mrkdwn for Slack webhooks
+	TextHTML                       // HTML fragment for the body of emails
+)
+
+func (f TextFormat) String() string {
+	switch f {
+	case TextSlack:
+		return "slack"
+	case TextHTML:
+		return "html"
+	default:
+		return "markdown"
+	}
+}
+
+func (f TextFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *TextFormat) UnmarshalText(text []byte) error {
+	for _, format := range []TextFormat{TextMarkdown, TextSlack, TextHTML} {
+		if strings.EqualFold(string(text), format.String()) {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown text format %q", text)
+}
+
+// Returns the escape function of the format, or of the message if format is nil.
+func (f *TextFormat) escaper(markup bool) func(string) string {
+	switch {
+	case f == nil && markup:
+		return escapeMarkup
+	case f == nil:
+		return func(s string) string { return s }
+	case *f == TextSlack:
+		return slackMarkdown.escape
+	default:
+		return markdown.escape
+	}
+}
+
+// Notification text as templates, rendered with structured data instead of formatting it at every call site.
+//
+//	Title, Subtitle, Message and GroupKey are text/template templates.
+//	Variants are the message for backends rendering another format. Backends without a variant convert Message.
+//	The HTML variant is an html/template template, which escapes the data.
+//	The escape function escapes a value for the template's format, e.g. {{escape .Host}}.
+//	Missing map keys are errors.
+type Template struct {
+	Title    string
+	Subtitle string
+	Message  string // Plain text, or markup if Markup is set
+	Markup   bool
+	Variants map[TextFormat]string
+	GroupKey string
+
+	Severity Severity
+	Tags     []string
+	Actions  []Action
+
+	Sample any // Data to render at registration, which catches errors parsing can't, e.g. unknown fields
+}
+
+// Parsed Template.
+type compiledTemplate struct {
+	def      Template
+	title    *template.Template
+	subtitle *template.Template
+	message  *template.Template
+	groupKey *template.Template
+	text     map[TextFormat]*template.Template
+	html     *htmltemplate.Template
+}
+
+// Registry of named templates.
+//
+// Each Dispatcher renders with its own registry, see DispatcherOptions.Templates.
+// The package functions such as RegisterTemplate use a default registry.
+type Templates struct {
+	mu        sync.RWMutex
+	templates map[string]*compiledTemplate
+}
+
+func NewTemplates() *Templates {
+	return &Templates{templates: make(map[string]*compiledTemplate)}
+}
+
+// Parses and registers a template. A template with the same name is replaced.
+func (r *Templates) Register(name string, t Template) error {
+	c, err := compileTemplate(name, t)
+	if err != nil {
+		return fmt.Errorf("template %q: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[name] = c
+	return nil
+}
+
+// Like Register, but panics on errors. Meant for package initialization.
+func (r *Templates) MustRegister(name string, t Template) {
+	err := r.Register(name, t)
+	if err != nil {
+		panic("notify: " + err.Error())
+	}
+}
+
+// Returns the names of the registered templates, sorted.
+func (r *Templates) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Renders the template registered under name with data.
+func (r *Templates) Render(name string, data any) (Notification, error) {
+	r.mu.RLock()
+	c, ok := r.templates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return Notification{}, fmt.Errorf("unknown notification template %q", name)
+	}
+	n, err := c.render(data)
+	if err != nil {
+		return Notification{}, fmt.Errorf("template %q: %w", name, err)
+	}
+	return n, nil
+}
+
+var defaultTemplates = sync.OnceValue(NewTemplates)
+
+// Registers a template for SendTemplate and the dispatchers without own Templates.
+func RegisterTemplate(name string, t Template) error {
+	return defaultTemplates().Register(name, t)
+}
+
+// Like RegisterTemplate, but panics on errors. Meant for package initialization.
+func MustRegisterTemplate(name string, t Template) {
+	defaultTemplates().MustRegister(name, t)
+}
+
+// Returns the names of the templates registered with RegisterTemplate, sorted.
+func TemplateNames() []string {
+	return defaultTemplates().Names()
+}
+
+// Renders the template registered with RegisterTemplate under name with data.
+func RenderTemplate(name string, data any) (Notification, error) {
+	return defaultTemplates().Render(name, data)
+}
+
+// Renders the template registered under name and sends it with the default dispatcher, like Send.
+// Render errors are reported by the returned Delivery.
+func SendTemplate(ctx context.Context, name string, data any) *Delivery {
+	return defaultDispatcher().SendTemplate(ctx, name, data)
+}
+
+func compileTemplate(name string, t Template) (*compiledTemplate, error) {
+	if strings.TrimSpace(t.Title) == "" {
+		return nil, fmt.Errorf("title cannot be empty")
+	}
+	n := Notification{Title: t.Title, Severity: t.Severity, Actions: t.Actions}
+	err := n.Validate()
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledTemplate{def: t, text: make(map[TextFormat]*template.Template)}
+	var errs []error
+	parse := func(field, text string, format *TextFormat, markup bool) *template.Template {
+		if text == "" {
+			return nil
+		}
+		funcs := template.FuncMap{"escape": format.escaper(markup)}
+		tmpl, err := template.New(name + "." + field).Option("missingkey=error").Funcs(funcs).Parse(text)
+		errs = append(errs, err)
+		return tmpl
+	}
+	c.title = parse("title", t.Title, nil, false)
+	c.subtitle = parse("subtitle", t.Subtitle, nil, false)
+	c.message = parse("message", t.Message, nil, t.Markup)
+	c.groupKey = parse("group", t.GroupKey, nil, false)
+	for format, text := range t.Variants {
+		if text == "" {
+			continue
+		}
+		switch format {
+		case TextMarkdown, TextSlack:
+			c.text[format] = parse(format.String(), text, &format, false)
+		case TextHTML:
+			funcs := htmltemplate.FuncMap{"escape": func(s string) string { return s }} // html/template escapes by itself
+			tmpl, err := htmltemplate.New(name + ".html").Option("missingkey=error").Funcs(funcs).Parse(text)
+			errs = append(errs, err)
+			c.html = tmpl
+		default:
+			errs = append(errs, fmt.Errorf("invalid text format %d", format))
+		}
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	if t.Sample != nil {
+		_, err = c.render(t.Sample)
+		if err != nil {
+			return nil, fmt.Errorf("sample: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Executes the templates with data.
+func (c *compiledTemplate) render(data any) (Notification, error) {
+	var errs []error
+	execute := func(tmpl interface {
+		Execute(io.Writer, any) error
+	}) string {
+		var b strings.Builder
+		errs = append(errs, tmpl.Execute(&b, data))
+		return b.String()
+	}
+	n := Notification{
+		Title:    execute(c.title),
+		Markup:   c.def.Markup,
+		Severity: c.def.Severity,
+		Tags:     c.def.Tags,
+		Actions:  c.def.Actions,
+	}
+	if c.subtitle != nil {
+		n.Subtitle = execute(c.subtitle)
+	}
+	if c.message != nil {
+		n.Message = execute(c.message)
+	}
+	if c.groupKey != nil {
+		n.GroupKey = execute(c.groupKey)
+	}
+	if len(c.text) > 0 || c.html != nil {
+		n.Variants = make(map[TextFormat]string, len(c.text)+1)
+	}
+	for format, tmpl := range c.text {
+		n.Variants[format] = execute(tmpl)
+	}
+	if c.html != nil {
+		n.Variants[TextHTML] = execute(c.html)
+	}
+	return n, errors.Join(errs...)
+}
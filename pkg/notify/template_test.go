@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesRender(t *testing.T) {
+	templates := NewTemplates()
+	err := templates.Register("backup", Template{
+		Title:    "Backup of {{.Host}} failed",
+		Message:  "<b>{{escape .Reason}}</b>",
+		Markup:   true,
+		Variants: map[TextFormat]string{TextSlack: "*{{escape .Reason}}*", TextHTML: "<b>{{.Reason}}</b>"},
+		GroupKey: "backup-{{.Host}}",
+		Severity: SeverityError,
+		Sample:   map[string]string{"Host": "db", "Reason": "disk full"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := templates.Render("backup", map[string]string{"Host": "db1", "Reason": "<disk> & *full*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Notification{
+		Title:    "Backup of db1 failed",
+		Message:  "<b>&lt;disk&gt; &amp; *full*</b>",
+		Markup:   true,
+		GroupKey: "backup-db1",
+		Severity: SeverityError,
+	}
+	variants := n.Variants
+	n.Variants = nil
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("rendered %+v, want %+v", n, want)
+	}
+	if got := variants[TextSlack]; got != "*&lt;disk&gt; &amp; *full**" {
+		t.Errorf("Slack variant = %q", got)
+	}
+	if got := variants[TextHTML]; got != "<b>&lt;disk&gt; &amp; *full*</b>" {
+		t.Errorf("HTML variant = %q", got)
+	}
+
+	_, err = templates.Render("backup", map[string]string{"Host": "db1"})
+	if err == nil || !strings.Contains(err.Error(), "Reason") {
+		t.Errorf("missing key: error = %v", err)
+	}
+	_, err = templates.Render("unknown", nil)
+	if err == nil {
+		t.Error("unknown template rendered")
+	}
+	err = templates.Register("bad", Template{Title: "{{.Host}}", Sample: map[string]string{}})
+	if err == nil {
+		t.Error("sample without the field accepted")
+	}
+	if names := templates.Names(); !slices.Equal(names, []string{"backup"}) {
+		t.Errorf("names = %q", names)
+	}
+}
+
+func TestDispatcherTemplates(t *testing.T) {
+	var titles []string
+	notifier := NotifierFunc(func(ctx context.Context, n Notification) error {
+		titles = append(titles, n.Title)
+		return nil
+	})
+	var failed []error
+	own := NewTemplates()
+	own.MustRegister("greeting", Template{Title: "Hello {{.}}"})
+	d := NewDispatcher(DispatcherOptions{Notifier: notifier, Templates: own, OnResult: func(n Notification, err error) {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}})
+	defer d.Close()
+
+	// The default registry doesn't leak into a dispatcher with its own
+	MustRegisterTemplate("test-default", Template{Title: "Default {{.}}"})
+	ctx := context.Background()
+	err := d.SendTemplate(ctx, "greeting", "world").Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SendTemplate(ctx, "test-default", "x").Wait(ctx)
+	if err == nil || len(failed) != 1 || !errors.Is(failed[0], err) {
+		t.Errorf("unknown template: error = %v, reported %v", err, failed)
+	}
+	if !slices.Equal(titles, []string{"Hello world"}) {
+		t.Errorf("delivered %q", titles)
+	}
+	if !slices.Contains(TemplateNames(), "test-default") || slices.Contains(TemplateNames(), "greeting") {
+		t.Errorf("default templates = %q", TemplateNames())
+	}
+}
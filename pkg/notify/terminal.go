@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+func init() {
+	Register(Backend{
+		Name:      "terminal",
+		Priority:  1,
+		Available: func() bool { return isTerminal(os.Stdout) || isTerminal(os.Stderr) },
+		New:       func() (Notifier, error) { return NewTerminal(), nil },
+	})
+}
+
+type TerminalProtocol int
+
+const (
+	TerminalBanner TerminalProtocol = iota // Bell and a banner on stderr
+	TerminalOSC9                           // OSC 9, e.g. iTerm2
+	TerminalOSC777                         // OSC 777 notify, e.g. WezTerm, foot, Ghostty, urxvt
+	TerminalOSC99                          // OSC 99, kitty's desktop notification protocol
+)
+
+func (p TerminalProtocol) String() string {
+	switch p {
+	case TerminalOSC9:
+		return "osc9"
+	case TerminalOSC777:
+		return "osc777"
+	case TerminalOSC99:
+		return "osc99"
+	default:
+		return "banner"
+	}
+}
+
+// Detects the notification protocol of the terminal from TERM and TERM_PROGRAM.
+//
+// Multiplexers like tmux and screen don't forward the sequences, so they get the banner.
+func DetectTerminalProtocol() TerminalProtocol {
+	if !isTerminal(os.Stdout) {
+		return TerminalBanner
+	}
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen") || strings.HasPrefix(term, "tmux"):
+		return TerminalBanner
+	case term == "xterm-kitty" || os.Getenv("KITTY_WINDOW_ID") != "":
+		return TerminalOSC99
+	case program == "iTerm.app":
+		return TerminalOSC9
+	case program == "WezTerm", program == "ghostty", term == "xterm-ghostty",
+		term == "foot", strings.HasPrefix(term, "foot-"), strings.HasPrefix(term, "rxvt-unicode"):
+		return TerminalOSC777
+	default:
+		return TerminalBanner
+	}
+}
+
+// Shows notifications in the terminal.
+//
+//	Terminals with a notification protocol get an escape sequence on Out, which they turn into a desktop notification.
+//	Other terminals get a banner on Err, with the bell and colours if enabled.
+//	Control characters are removed from the text, so it can't inject escape sequences.
+type Terminal struct {
+	Protocol TerminalProtocol
+	Out      io.Writer // Receives the escape sequences
+	Err      io.Writer // Receives the banner
+	Bell     bool      // Ring the bell with the banner
+	Color    bool      // Colour the banner by severity
+}
+
+// Creates a terminal notifier for stdout and stderr with the detected protocol.
+// The banner rings the bell if stderr is a terminal, and is coloured unless NO_COLOR is set.
+func NewTerminal() *Terminal {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	tty := isTerminal(os.Stderr)
+	return &Terminal{
+		Protocol: DetectTerminalProtocol(),
+		Out:      os.Stdout,
+		Err:      os.Stderr,
+		Bell:     tty,
+		Color:    tty && !noColor,
+	}
+}
+
+// Reports whether the terminal replaces notifications with the same GroupKey.
+// Only kitty's protocol supports it.
+func (t *Terminal) ReplacesGroup() bool {
+	return t.Protocol == TerminalOSC99
+}
+
+func (t *Terminal) Notify(ctx context.Context, n Notification) error {
+	cfg := CurrentConfig()
+	n = cfg.apply(n)
+	title := terminalText(n.Title)
+	body := terminalText(plainBody(n))
+
+	var seq string
+	w := t.Out
+	switch t.Protocol {
+	case TerminalOSC9:
+		seq = "\x1b]9;" + joinTerminal(title, body) + "\x07"
+	case TerminalOSC777:
+		// The title ends at the first semicolon
+		seq = "\x1b]777;notify;" + strings.ReplaceAll(title, ";", ",") + ";" + body + "\x07"
+	case TerminalOSC99:
+		seq = kittyNotification(cfg, n)
+	default:
+		seq = t.banner(n.Severity, title, body)
+		w = t.Err
+	}
+	_, err := io.WriteString(w, seq)
+	if err != nil {
+		return &Error{Backend: "terminal", Kind: ErrTransport, Err: err}
+	}
+	return nil
+}
+
+var kittySeq atomic.Uint32 // identifiers of notifications without group key
+
+// Returns the OSC 99 sequences for kitty.
+// The payloads are base64 encoded, so they need no escaping.
+func kittyNotification(cfg Config, n Notification) string {
+	// Notifications with the same identifier replace each other
+	id := fmt.Sprintf("n%d", kittySeq.Add(1))
+	if n.GroupKey != "" {
+		h := fnv.New32a()
+		h.Write([]byte(n.GroupKey))
+		id = fmt.Sprintf("%08x", h.Sum32())
+	}
+	urgency := map[Urgency]int{UrgencyLow: 0, UrgencyNormal: 1, UrgencyCritical: 2}[n.Urgency]
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	metadata := fmt.Sprintf("i=%s:u=%d:f=%s:e=1", id, urgency, encode(cfg.AppName))
+	seq := "\x1b]99;" + metadata + ":d=0:p=title;" + encode(n.Title) + "\x1b\\"
+	if body := plainBody(n); body != "" {
+		seq += "\x1b]99;" + metadata + ":d=1:p=body;" + encode(body) + "\x1b\\"
+	} else {
+		seq += "\x1b]99;i=" + id + ":d=1;\x1b\\"
+	}
+	return seq
+}
+
+// Returns a one line banner, e.g. ` ERROR  Backup failed: disk full`.
+func (t *Terminal) banner(severity Severity, title, body string) string {
+	label := " " + strings.ToUpper(severity.String()) + " "
+	if t.Color {
+		color := map[Severity]string{SeverityInfo: "44", SeverityWarning: "30;43", SeverityError: "41"}[severity]
+		label = "\x1b[1;" + color + "m" + label + "\x1b[0m"
+	}
+	if t.Bell {
+		label = "\a" + label
+	}
+	return label + " " + joinTerminal(title, body) + "\n"
+}
+
+func joinTerminal(title, body string) string {
+	switch {
+	case title == "":
+		return body
+	case body == "":
+		return title
+	default:
+		return title + ": " + body
+	}
+}
+
+// Replaces line breaks by spaces and removes other control characters.
+func terminalText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
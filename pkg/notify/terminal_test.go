@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestTerminal(t *testing.T) {
+	hostile := Notification{
+		Title:    "a\x1b]9;x\x07b\u009c;c\x9c", // a raw C1 byte is invalid UTF-8 and replaced
+		Subtitle: "sub\ttitle",
+		Message:  "line\nbreak\x1b\\ end\x07 ;",
+	}
+	tests := []struct {
+		name     string
+		protocol TerminalProtocol
+		bell     bool
+		color    bool
+		n        Notification
+		out, err string
+	}{
+		{"OSC 9", TerminalOSC9, false, false, Notification{Title: "Build", Message: "done"},
+			"\x1b]9;Build: done\x07", ""},
+		{"OSC 9 title only", TerminalOSC9, false, false, Notification{Title: "Build"},
+			"\x1b]9;Build\x07", ""},
+		{"OSC 9 hostile", TerminalOSC9, false, false, hostile,
+			"\x1b]9;a]9;xb;c\ufffd: sub title line break\\ end ;\x07", ""},
+		{"OSC 777", TerminalOSC777, false, false, Notification{Title: "Build", Message: "done"},
+			"\x1b]777;notify;Build;done\x07", ""},
+		{"OSC 777 hostile", TerminalOSC777, false, false, hostile,
+			"\x1b]777;notify;a]9,xb,c\ufffd;sub title line break\\ end ;\x07", ""},
+		{"banner", TerminalBanner, false, false, Notification{Title: "Build", Message: "done"},
+			"", " INFO  Build: done\n"},
+		{"banner with bell and color", TerminalBanner, true, true, Notification{Title: "Build", Message: "failed", Severity: SeverityError},
+			"", "\a\x1b[1;41m ERROR \x1b[0m Build: failed\n"},
+		{"banner hostile", TerminalBanner, false, true, hostile,
+			"", "\x1b[1;44m INFO \x1b[0m a]9;xb;c\ufffd: sub title line break\\ end ;\n"},
+	}
+	for _, tt := range tests {
+		var out, errOut strings.Builder
+		term := &Terminal{Protocol: tt.protocol, Out: &out, Err: &errOut, Bell: tt.bell, Color: tt.color}
+		err := term.Notify(context.Background(), tt.n)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if out.String() != tt.out || errOut.String() != tt.err {
+			t.Errorf("%s:\nout %q, want %q\nerr %q, want %q", tt.name, out.String(), tt.out, errOut.String(), tt.err)
+		}
+	}
+
+	err := (&Terminal{Protocol: TerminalOSC9, Out: failingWriter{}}).Notify(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrTransport) {
+		t.Errorf("error = %v, want %v", err, ErrTransport)
+	}
+}
+
+func TestKittyNotification(t *testing.T) {
+	// The group key e20c2606 is the FNV-1a hash of "g"
+	tests := []struct {
+		name string
+		n    Notification
+		want string
+	}{
+		{"group", Notification{Title: "T", Message: "B", GroupKey: "g"},
+			"\x1b]99;i=e20c2606:u=1:f=YXBw:e=1:d=0:p=title;VA==\x1b\\" +
+				"\x1b]99;i=e20c2606:u=1:f=YXBw:e=1:d=1:p=body;Qg==\x1b\\"},
+		{"urgency", Notification{Title: "T", Message: "B", GroupKey: "g", Severity: SeverityError},
+			"\x1b]99;i=e20c2606:u=2:f=YXBw:e=1:d=0:p=title;VA==\x1b\\" +
+				"\x1b]99;i=e20c2606:u=2:f=YXBw:e=1:d=1:p=body;Qg==\x1b\\"},
+		// Control characters are encoded, so they can't end the sequence
+		{"hostile", Notification{Title: "\x1b\\ \a", Subtitle: "Sub", Message: "B;1", GroupKey: "g", Urgency: UrgencyLow},
+			"\x1b]99;i=e20c2606:u=0:f=YXBw:e=1:d=0:p=title;G1wgBw==\x1b\\" +
+				"\x1b]99;i=e20c2606:u=0:f=YXBw:e=1:d=1:p=body;U3ViCkI7MQ==\x1b\\"},
+	}
+	for _, tt := range tests {
+		if got := kittyNotification(testConfig, testConfig.apply(tt.n)); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Without group key, every notification gets its own identifier, and an empty body ends it
+	id := fmt.Sprintf("n%d", kittySeq.Load()+1)
+	want := "\x1b]99;i=" + id + ":u=1:f=YXBw:e=1:d=0:p=title;VA==\x1b\\" + "\x1b]99;i=" + id + ":d=1;\x1b\\"
+	if got := kittyNotification(testConfig, testConfig.apply(Notification{Title: "T"})); got != want {
+		t.Errorf("no group:\n got %q\nwant %q", got, want)
+	}
+}
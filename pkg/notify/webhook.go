@@ -0,0 +1,493 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookRetries    = 3
+	defaultWebhookMinBackoff = time.Second
+	defaultWebhookMaxBackoff = 30 * time.Second
+)
+
+type WebhookFormat int
+
+const (
+	WebhookJSON    WebhookFormat = iota // Generic JSON with all notification fields
+	WebhookSlack                        // Slack incoming webhook
+	WebhookDiscord                      // Discord webhook
+	WebhookTeams                        // Microsoft Teams workflow webhook with an Adaptive Card
+)
+
+func (f WebhookFormat) String() string {
+	switch f {
+	case WebhookSlack:
+		return "slack"
+	case WebhookDiscord:
+		return "discord"
+	case WebhookTeams:
+		return "teams"
+	default:
+		return "json"
+	}
+}
+
+func (f WebhookFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *WebhookFormat) UnmarshalText(text []byte) error {
+	for _, format := range []WebhookFormat{WebhookJSON, WebhookSlack, WebhookDiscord, WebhookTeams} {
+		if strings.EqualFold(string(text), format.String()) {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown webhook format %q", text)
+}
+
+// Webhook settings, e.g. from a config file.
+//
+// Webhook URLs are secrets. Instead of the URL itself, URL can reference it:
+//
+//	env:NAME   reads the URL from the environment variable NAME
+//	file:PATH  reads the URL from the file at PATH, e.g. a mounted secret
+type WebhookConfig struct {
+	Format     WebhookFormat     `json:"format"`
+	URL        string            `json:"url"`
+	Header     map[string]string `json:"header,omitempty"`  // Additional request headers
+	Retries    int               `json:"retries,omitempty"` // Retries after a failed request. Defaults to 3, negative disables retries
+	MinBackoff time.Duration     `json:"-"`                 // First retry delay. Defaults to 1s
+	MaxBackoff time.Duration     `json:"-"`                 // Upper bound for retry delays. A longer Retry-After fails right away. Defaults to 30s
+	Client     *http.Client      `json:"-"`                 // HTTP client. Defaults to a client with a 30s timeout
+}
+
+// Posts notifications to a chat or HTTP endpoint.
+//
+//	Server errors, timeouts and 429 are retried with exponential backoff. Retry-After is honoured.
+//	Actions are dropped, since incoming webhooks have no way to report the user's response.
+//	Errors never contain the URL.
+type Webhook struct {
+	cfg WebhookConfig
+	url string
+}
+
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	// Check webhook config
+	if cfg.Format < WebhookJSON || cfg.Format > WebhookTeams {
+		return nil, fmt.Errorf("invalid webhook format %d", cfg.Format)
+	}
+	rawURL, err := resolveSecret(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("webhook URL: %w", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL")
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = defaultWebhookRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultWebhookMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultWebhookMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Webhook{cfg: cfg, url: rawURL}, nil
+}
+
+// Returns the value of a secret reference. Values without a known prefix are returned as is.
+func resolveSecret(ref string) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		var ok bool
+		value, ok = os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		value = string(data)
+	default:
+		value = ref
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("empty secret")
+	}
+	return value, nil
+}
+
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	cfg := CurrentConfig()
+	body, err := json.Marshal(w.payload(cfg, cfg.apply(n)))
+	if err != nil {
+		return &Error{Backend: w.cfg.Format.String(), Kind: ErrRejected, Err: err}
+	}
+	return w.post(ctx, body)
+}
+
+// Posts body, retrying failed requests.
+func (w *Webhook) post(ctx context.Context, body []byte) error {
+	backend := w.cfg.Format.String()
+	backoff := w.cfg.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := w.postOnce(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var e *Error
+		if attempt >= w.cfg.Retries || (errors.As(err, &e) && e.Kind == ErrRejected && retryAfter == 0) || ctx.Err() != nil {
+			return deliveryError(ctx, backend, ErrTransport, err)
+		}
+		wait := backoff
+		if retryAfter > 0 {
+			// Retrying earlier is pointless, so a delay beyond the limits fails right away
+			deadline, ok := ctx.Deadline()
+			if retryAfter > w.cfg.MaxBackoff || (ok && time.Until(deadline) < retryAfter) {
+				return &Error{Backend: backend, Kind: ErrRejected, Err: fmt.Errorf("%w, retry after %v", e.Err, retryAfter)}
+			}
+			wait = retryAfter
+		}
+		backoff = min(backoff*2, w.cfg.MaxBackoff)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return deliveryError(ctx, backend, ErrTransport, err)
+		}
+	}
+}
+
+// Sends a single request.
+//
+//	Returns the Retry-After delay of 429 responses.
+//	Client errors other than 408 and 429 are ErrRejected and not retried.
+func (w *Webhook) postOnce(ctx context.Context, body []byte) (time.Duration, error) {
+	backend := w.cfg.Format.String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, &Error{Backend: backend, Kind: ErrRejected, Err: fmt.Errorf("invalid webhook request")}
+	}
+	for k, v := range w.cfg.Header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.cfg.Client.Do(req)
+	if err != nil {
+		// The URL contains the secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = fmt.Errorf("%s webhook: %w", urlErr.Op, urlErr.Err)
+		}
+		return 0, err
+	}
+	defer res.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return 0, nil
+	case res.StatusCode == http.StatusTooManyRequests:
+		return max(parseRetryAfter(res.Header.Get("Retry-After")), w.cfg.MinBackoff),
+			&Error{Backend: backend, Kind: ErrRejected, Err: statusError(res, text)}
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode >= 500:
+		return 0, statusError(res, text)
+	default:
+		return 0, &Error{Backend: backend, Kind: ErrRejected, Err: statusError(res, text)}
+	}
+}
+
+func statusError(res *http.Response, text []byte) error {
+	if msg := strings.TrimSpace(string(text)); msg != "" {
+		return fmt.Errorf("webhook returned %s: %s", res.Status, msg)
+	}
+	return fmt.Errorf("webhook returned %s", res.Status)
+}
+
+// Parses a Retry-After header given in seconds or as HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// Returns the request body for the webhook format.
+func (w *Webhook) payload(cfg Config, n Notification) any {
+	switch w.cfg.Format {
+	case WebhookSlack:
+		return slackPayload(cfg, n)
+	case WebhookDiscord:
+		return discordPayload(cfg, n)
+	case WebhookTeams:
+		return teamsPayload(cfg, n)
+	default:
+		return jsonPayload(cfg, n)
+	}
+}
+
+func jsonPayload(cfg Config, n Notification) any {
+	type action struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	}
+	actions := make([]action, len(n.Actions))
+	for i, a := range n.Actions {
+		actions[i] = action{a.ID, a.Label}
+	}
+	return struct {
+		App      string    `json:"app"`
+		Time     time.Time `json:"time"`
+		Title    string    `json:"title"`
+		Subtitle string    `json:"subtitle,omitempty"`
+		Message  string    `json:"message"`
+		HTML     string    `json:"html,omitempty"`
+		Severity string    `json:"severity"`
+		Urgency  string    `json:"urgency"`
+		Tags     []string  `json:"tags,omitempty"`
+		Group    string    `json:"group,omitempty"`
+		Actions  []action  `json:"actions,omitempty"`
+	}{
+		App:      cfg.AppName,
+		Time:     time.Now(),
+		Title:    n.Title,
+		Subtitle: n.Subtitle,
+		Message:  plainMessage(n),
+		HTML:     markupIfSet(n),
+		Severity: n.Severity.String(),
+		Urgency:  n.Urgency.String(),
+		Tags:     n.Tags,
+		Group:    n.GroupKey,
+		Actions:  actions,
+	}
+}
+
+func markupIfSet(n Notification) string {
+	if text, ok := n.Variants[TextHTML]; ok {
+		return text
+	}
+	if n.Markup {
+		return n.Message
+	}
+	return ""
+}
+
+func slackPayload(cfg Config, n Notification) any {
+	text := slackMarkdown.convert(n, TextSlack)
+	if n.Subtitle != "" {
+		text = joinLines("*"+slackMarkdown.escape(n.Subtitle)+"*", text)
+	}
+	type attachment struct {
+		Color    string   `json:"color"`
+		Title    string   `json:"title"`
+		Text     string   `json:"text,omitempty"`
+		Fallback string   `json:"fallback"`
+		Footer   string   `json:"footer,omitempty"`
+		Markdown []string `json:"mrkdwn_in"`
+	}
+	return struct {
+		Text        string       `json:"text"`
+		Attachments []attachment `json:"attachments"`
+	}{
+		Text: slackMarkdown.escape(n.Title),
+		Attachments: []attachment{{
+			Color:    fmt.Sprintf("#%06X", severityColor(n.Severity)),
+			Title:    n.Title,
+			Text:     text,
+			Fallback: n.Title + ": " + plainBody(n),
+			Footer:   slackMarkdown.escape(footer(cfg, n)),
+			Markdown: []string{"text"},
+		}},
+	}
+}
+
+func discordPayload(cfg Config, n Notification) any {
+	type footerText struct {
+		Text string `json:"text"`
+	}
+	type embed struct {
+		Title       string     `json:"title"`
+		Description string     `json:"description,omitempty"`
+		Color       uint32     `json:"color"`
+		Footer      footerText `json:"footer"`
+		Timestamp   time.Time  `json:"timestamp"`
+	}
+	description := markdown.convert(n, TextMarkdown)
+	if n.Subtitle != "" {
+		description = joinLines("**"+markdown.escape(n.Subtitle)+"**", description)
+	}
+	return struct {
+		Username string  `json:"username"`
+		Embeds   []embed `json:"embeds"`
+	}{
+		Username: cfg.AppName,
+		Embeds: []embed{{
+			Title:       truncateRunes(n.Title, 256),
+			Description: truncateRunes(description, 4096),
+			Color:       severityColor(n.Severity),
+			Footer:      footerText{footer(cfg, n)},
+			Timestamp:   time.Now(),
+		}},
+	}
+}
+
+func teamsPayload(cfg Config, n Notification) any {
+	type element map[string]any
+	body := []element{{
+		"type":   "TextBlock",
+		"text":   markdown.escape(n.Title),
+		"size":   "Large",
+		"weight": "Bolder",
+		"color":  map[Severity]string{SeverityInfo: "Default", SeverityWarning: "Warning", SeverityError: "Attention"}[n.Severity],
+		"wrap":   true,
+	}}
+	if n.Subtitle != "" {
+		body = append(body, element{"type": "TextBlock", "text": markdown.escape(n.Subtitle), "weight": "Bolder", "wrap": true})
+	}
+	if n.Message != "" || n.Variants[TextMarkdown] != "" {
+		body = append(body, element{"type": "TextBlock", "text": markdown.convert(n, TextMarkdown), "wrap": true})
+	}
+	body = append(body, element{"type": "TextBlock", "text": markdown.escape(footer(cfg, n)), "size": "Small", "isSubtle": true, "wrap": true})
+	return element{
+		"type": "message",
+		"attachments": []element{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": element{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+// Returns the app name and tags, e.g. `backup · nightly, db`.
+func footer(cfg Config, n Notification) string {
+	if len(n.Tags) == 0 {
+		return cfg.AppName
+	}
+	return cfg.AppName + " · " + strings.Join(n.Tags, ", ")
+}
+
+// Returns the RGB color of the severity.
+func severityColor(s Severity) uint32 {
+	switch s {
+	case SeverityWarning:
+		return 0xF2C744
+	case SeverityError:
+		return 0xD93F0B
+	default:
+		return 0x439FE0
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// Markdown dialect of a chat service.
+type markdownSyntax struct {
+	bold, italic string
+	linkOpen     func(url string) string
+	linkClose    func(url string) string
+	escaper      *strings.Replacer
+}
+
+var (
+	markupLink = regexp.MustCompile(`(?i)^<a\s+href="([^"]*)"\s*>$`)
+
+	slackMarkdown = markdownSyntax{
+		bold:      "*",
+		italic:    "_",
+		linkOpen:  func(url string) string { return "<" + url + "|" },
+		linkClose: func(string) string { return ">" },
+		escaper:   strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;"),
+	}
+	markdown = markdownSyntax{
+		bold:      "**",
+		italic:    "_",
+		linkOpen:  func(string) string { return "[" },
+		linkClose: func(url string) string { return "](" + url + ")" },
+		escaper: strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`,
+			"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`, "#", `\#`),
+	}
+)
+
+func (m markdownSyntax) escape(s string) string {
+	return m.escaper.Replace(s)
+}
+
+// Returns the variant of the message in format, or converts the message to markdown.
+// Markup tags without a markdown equivalent are dropped.
+func (m markdownSyntax) convert(n Notification, format TextFormat) string {
+	if text, ok := n.Variants[format]; ok {
+		return text
+	}
+	if !n.Markup {
+		return m.escape(n.Message)
+	}
+	var b strings.Builder
+	link := ""
+	last := 0
+	for _, loc := range markupTag.FindAllStringIndex(n.Message, -1) {
+		b.WriteString(m.escape(html.UnescapeString(n.Message[last:loc[0]])))
+		last = loc[1]
+		tag := n.Message[loc[0]:loc[1]]
+		switch strings.ToLower(tag) {
+		case "<b>", "</b>":
+			b.WriteString(m.bold)
+		case "<i>", "</i>":
+			b.WriteString(m.italic)
+		case "</a>":
+			if link != "" {
+				b.WriteString(m.linkClose(link))
+				link = ""
+			}
+		default:
+			if match := markupLink.FindStringSubmatch(tag); match != nil && link == "" {
+				link = html.UnescapeString(match[1])
+				b.WriteString(m.linkOpen(link))
+			}
+		}
+	}
+	b.WriteString(m.escape(html.UnescapeString(n.Message[last:])))
+	if link != "" {
+		b.WriteString(m.linkClose(link))
+	}
+	return b.String()
+}
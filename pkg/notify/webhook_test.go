@@ -0,0 +1,387 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Part of the webhook URL, which must never show up in errors.
+const webhookSecret = "T000/B000/secret-token"
+
+type webhookRequest struct {
+	header http.Header
+	body   map[string]any
+}
+
+// Starts an endpoint, which answers the n-th request with respond(w, n) and reports every request.
+func webhookEndpoint(t *testing.T, respond func(w http.ResponseWriter, n int)) (string, <-chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 100)
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			t.Errorf("invalid JSON body: %v", err)
+		}
+		requests <- webhookRequest{r.Header, body}
+		respond(w, int(n.Add(1))-1)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/" + webhookSecret, requests
+}
+
+func respondStatus(status ...int) func(w http.ResponseWriter, n int) {
+	return func(w http.ResponseWriter, n int) {
+		w.WriteHeader(status[min(n, len(status)-1)])
+	}
+}
+
+func newTestWebhook(t *testing.T, cfg WebhookConfig) *Webhook {
+	t.Helper()
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = time.Millisecond
+		cfg.MaxBackoff = 10 * time.Millisecond
+	}
+	w, err := NewWebhook(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// Returns the value at the path of object keys and array indexes.
+func jsonPath(v any, path ...string) any {
+	for _, p := range path {
+		switch w := v.(type) {
+		case map[string]any:
+			v = w[p]
+		case []any:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(w) {
+				return nil
+			}
+			v = w[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+var webhookNotification = Notification{
+	Title:    "Backup <failed>",
+	Subtitle: "db_1",
+	Message:  `<b>disk</b> full, see <a href="https://example.com/?a=1&amp;b=2">logs</a>`,
+	Markup:   true,
+	Severity: SeverityError,
+	Tags:     []string{"nightly", "db"},
+	GroupKey: "backup",
+	Actions:  []Action{{ID: "retry", Label: "Retry"}},
+}
+
+func TestWebhookPayloads(t *testing.T) {
+	app := CurrentConfig().AppName
+	tests := []struct {
+		format WebhookFormat
+		want   map[string]any // value by path of keys and indexes, separated by spaces
+	}{
+		{WebhookJSON, map[string]any{
+			"app":             app,
+			"title":           "Backup <failed>",
+			"subtitle":        "db_1",
+			"message":         "disk full, see logs",
+			"html":            webhookNotification.Message,
+			"severity":        "error",
+			"urgency":         "critical",
+			"tags 1":          "db",
+			"group":           "backup",
+			"actions 0 id":    "retry",
+			"actions 0 label": "Retry",
+		}},
+		{WebhookSlack, map[string]any{
+			"text":                      "Backup &lt;failed&gt;",
+			"attachments 0 color":       "#D93F0B",
+			"attachments 0 title":       "Backup <failed>",
+			"attachments 0 text":        "*db_1*\n*disk* full, see <https://example.com/?a=1&b=2|logs>",
+			"attachments 0 fallback":    "Backup <failed>: db_1\ndisk full, see logs",
+			"attachments 0 footer":      app + " · nightly, db",
+			"attachments 0 mrkdwn_in 0": "text",
+		}},
+		{WebhookDiscord, map[string]any{
+			"username":             app,
+			"embeds 0 title":       "Backup <failed>",
+			"embeds 0 description": "**db\\_1**\n**disk** full, see [logs](https://example.com/?a=1&b=2)",
+			"embeds 0 color":       float64(0xD93F0B),
+			"embeds 0 footer text": app + " · nightly, db",
+		}},
+		{WebhookTeams, map[string]any{
+			"type":                                  "message",
+			"attachments 0 contentType":             "application/vnd.microsoft.card.adaptive",
+			"attachments 0 content type":            "AdaptiveCard",
+			"attachments 0 content body 0 text":     `Backup \<failed\>`,
+			"attachments 0 content body 0 color":    "Attention",
+			"attachments 0 content body 1 text":     `db\_1`,
+			"attachments 0 content body 2 text":     "**disk** full, see [logs](https://example.com/?a=1&b=2)",
+			"attachments 0 content body 3 text":     app + " · nightly, db",
+			"attachments 0 content body 3 isSubtle": true,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			url, requests := webhookEndpoint(t, respondStatus(http.StatusOK))
+			w := newTestWebhook(t, WebhookConfig{Format: tt.format, URL: url, Header: map[string]string{"X-Token": "abc"}})
+			err := w.Notify(context.Background(), webhookNotification)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if ct := r.header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if token := r.header.Get("X-Token"); token != "abc" {
+				t.Errorf("X-Token = %q", token)
+			}
+			for path, want := range tt.want {
+				if got := jsonPath(r.body, strings.Fields(path)...); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookVariants(t *testing.T) {
+	url, requests := webhookEndpoint(t, respondStatus(http.StatusOK))
+	n := Notification{Title: "t", Message: "plain", Variants: map[TextFormat]string{TextSlack: "*slack*", TextHTML: "<b>html</b>"}}
+	for _, format := range []WebhookFormat{WebhookSlack, WebhookJSON} {
+		err := newTestWebhook(t, WebhookConfig{Format: format, URL: url}).Notify(context.Background(), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := jsonPath((<-requests).body, "attachments", "0", "text"); got != "*slack*" {
+		t.Errorf("Slack text = %v, want the variant", got)
+	}
+	body := (<-requests).body
+	if body["message"] != "plain" || body["html"] != "<b>html</b>" {
+		t.Errorf("JSON message = %v, html = %v", body["message"], body["html"])
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	url, requests := webhookEndpoint(t, respondStatus(http.StatusBadGateway, http.StatusRequestTimeout, http.StatusOK))
+	err := newTestWebhook(t, WebhookConfig{URL: url}).Notify(context.Background(), Notification{Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Errorf("sent %d requests, want 3", len(requests))
+	}
+
+	url, requests = webhookEndpoint(t, respondStatus(http.StatusServiceUnavailable))
+	err = newTestWebhook(t, WebhookConfig{URL: url, Retries: 2}).Notify(context.Background(), Notification{Title: "t"})
+	if !errors.Is(err, ErrTransport) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("error = %v, want %v with the status", err, ErrTransport)
+	}
+	if len(requests) != 3 {
+		t.Errorf("sent %d requests, want the first and 2 retries", len(requests))
+	}
+
+	url, requests = webhookEndpoint(t, respondStatus(http.StatusServiceUnavailable))
+	err = newTestWebhook(t, WebhookConfig{URL: url, Retries: -1}).Notify(context.Background(), Notification{Title: "t"})
+	if err == nil || len(requests) != 1 {
+		t.Errorf("retries disabled: error = %v after %d requests", err, len(requests))
+	}
+}
+
+func TestWebhookRejected(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound} {
+		url, requests := webhookEndpoint(t, func(w http.ResponseWriter, n int) {
+			http.Error(w, "invalid_payload", status)
+		})
+		err := newTestWebhook(t, WebhookConfig{URL: url}).Notify(context.Background(), Notification{Title: "t"})
+		if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "invalid_payload") {
+			t.Errorf("%d: error = %v, want %v with the response", status, err, ErrRejected)
+		}
+		if len(requests) != 1 {
+			t.Errorf("%d: sent %d requests, want no retry", status, len(requests))
+		}
+	}
+}
+
+func TestWebhookRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter func() string
+		wait       time.Duration // Least time until the retry
+	}{
+		{"seconds", func() string { return "1" }, time.Second},
+		// HTTP dates have whole seconds
+		{"HTTP date", func() string { return time.Now().Add(3 * time.Second).UTC().Format(http.TimeFormat) }, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryAfter := tt.retryAfter()
+			url, requests := webhookEndpoint(t, func(w http.ResponseWriter, n int) {
+				if n == 0 {
+					w.Header().Set("Retry-After", retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+			})
+			// The backoff alone would wait 1ms
+			w := newTestWebhook(t, WebhookConfig{URL: url, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Second})
+			start := time.Now()
+			err := w.Notify(context.Background(), Notification{Title: "t"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wait || elapsed > tt.wait+2*time.Second {
+				t.Errorf("retried after %v, want Retry-After %v", elapsed, tt.wait)
+			}
+			if len(requests) != 2 {
+				t.Errorf("sent %d requests, want 2", len(requests))
+			}
+		})
+	}
+
+	// A Retry-After beyond MaxBackoff or the deadline fails right away
+	url, requests := webhookEndpoint(t, func(w http.ResponseWriter, n int) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	short, cancelShort := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelShort()
+	for _, tt := range []struct {
+		name       string
+		ctx        context.Context
+		maxBackoff time.Duration
+	}{
+		{"MaxBackoff", ctx, 100 * time.Millisecond},
+		{"deadline", short, time.Minute},
+	} {
+		w := newTestWebhook(t, WebhookConfig{URL: url, MinBackoff: time.Millisecond, MaxBackoff: tt.maxBackoff})
+		start := time.Now()
+		err := w.Notify(tt.ctx, Notification{Title: "t"})
+		if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), "retry after 1s") {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, ErrRejected)
+		}
+		if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+			t.Errorf("%s: failed after %v", tt.name, elapsed)
+		}
+		if n := len(requests); n != 1 {
+			t.Errorf("%s: sent %d requests, want 1", tt.name, n)
+		}
+		<-requests
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 120 * time.Second, 120 * time.Second},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{time.Now().Add(time.Minute).UTC().Format(time.RFC850), 58 * time.Second, time.Minute},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v to %v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	url, requests := webhookEndpoint(t, respondStatus(http.StatusOK))
+	t.Setenv("TEST_WEBHOOK_URL", url)
+	file := filepath.Join(t.TempDir(), "url")
+	err := os.WriteFile(file, []byte(url+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"env:TEST_WEBHOOK_URL", "file:" + file} {
+		err := newTestWebhook(t, WebhookConfig{URL: ref}).Notify(context.Background(), Notification{Title: "t"})
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		<-requests
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(empty, []byte(" \n"), 0o600)
+	t.Setenv("TEST_WEBHOOK_INVALID", "ftp://example.com/"+webhookSecret)
+	for _, ref := range []string{"env:TEST_WEBHOOK_UNSET", "file:" + filepath.Join(t.TempDir(), "missing"), "file:" + empty, "env:TEST_WEBHOOK_INVALID", ""} {
+		_, err := NewWebhook(WebhookConfig{URL: ref})
+		if err == nil {
+			t.Errorf("%q: no error", ref)
+		} else if strings.Contains(err.Error(), webhookSecret) {
+			t.Errorf("%q: error contains the URL: %v", ref, err)
+		}
+	}
+}
+
+func TestWebhookErrorsHideURL(t *testing.T) {
+	// A closed listener refuses the connection
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	refused := newTestWebhook(t, WebhookConfig{URL: "http://" + l.Addr().String() + "/" + webhookSecret, Retries: -1})
+
+	// A client timeout
+	slow, _ := webhookEndpoint(t, func(w http.ResponseWriter, n int) { time.Sleep(100 * time.Millisecond) })
+	timeout := newTestWebhook(t, WebhookConfig{URL: slow, Retries: -1, Client: &http.Client{Timeout: 10 * time.Millisecond}})
+
+	// A redirect loop reports the redirected URL
+	loop, _ := webhookEndpoint(t, func(w http.ResponseWriter, n int) {
+		w.Header().Set("Location", "/"+webhookSecret+"/again")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	redirect := newTestWebhook(t, WebhookConfig{URL: loop, Retries: -1})
+
+	for name, w := range map[string]*Webhook{"refused": refused, "timeout": timeout, "redirect": redirect} {
+		err := w.Notify(context.Background(), Notification{Title: "t"})
+		if err == nil {
+			t.Errorf("%s: no error", name)
+			continue
+		}
+		if strings.Contains(err.Error(), webhookSecret) || strings.Contains(fmt.Sprintf("%+v", err), webhookSecret) {
+			t.Errorf("%s: error contains the URL: %v", name, err)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Backend != "json" {
+			t.Errorf("%s: error = %#v, want *Error", name, err)
+		}
+	}
+
+	// The context deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = newTestWebhook(t, WebhookConfig{URL: slow}).Notify(ctx, Notification{Title: "t"})
+	if !errors.Is(err, ErrTimeout) || strings.Contains(err.Error(), webhookSecret) {
+		t.Errorf("deadline: error = %v, want %v without the URL", err, ErrTimeout)
+	}
+}